@@ -0,0 +1,370 @@
+package qp
+
+import "math/bits"
+
+// Set algebra descends two tries at once. Wherever only one of them has keys
+// below a nibble position, that whole subtree is taken over and shared
+// copy-on-write with its source instead of being visited key by key.
+//
+// Both sources are shared first, like a snapshot, so a later change to a
+// source copies its path and leaves the result intact. The sources are only
+// read.
+
+// splitIndex returns the nibble index n branches at, or nibbleIndexMax for a leaf.
+func (n *gnode[V]) splitIndex() nibbleIndexT {
+	if n.isBranch() {
+		return n.index()
+	}
+	return nibbleIndexMax
+}
+
+// divergeIndex returns the first nibble index at which the keys under two
+// nodes, represented by ka and kb, can differ.
+func divergeIndex(ka, kb []byte) nibbleIndexT {
+	index, match := nibbleIndex(ka, kb)
+	if match {
+		return nibbleIndexMax
+	}
+	return index
+}
+
+// sameSubtree reports whether a and b are one subtree shared by two tries.
+func sameSubtree[V any](a, b *gnode[V]) bool {
+	return a.isBranch() && a.ptr == b.ptr && a.word&^cowFlag == b.word&^cowFlag
+}
+
+// adopt returns a copy of n to be placed in a twig array of another trie.
+func adopt[V any](n *gnode[V]) gnode[V] {
+	r := *n
+	r.markCow()
+	return r
+}
+
+// countLeaves returns the number of leaves under n, from its count unless that
+// is countMax.
+func countLeaves[V any](n *gnode[V]) int {
+	if c := n.count(); c < countMax {
+		return c
+	}
+	c := 0
+	for i := range n.twigOffsetMax() {
+		c += countLeaves(n.twig(i))
+	}
+	return c
+}
+
+// merger builds the result of a set operation. New twig arrays come from pool.
+type merger[V any] struct {
+	pool *twigPool[V]
+	// resolve returns the leaf kept for a key found in both tries.
+	// If nil, the leaf of the first trie is kept.
+	resolve func(a, b *gnode[V]) gnode[V]
+	// common counts the keys found in both tries by union.
+	common int
+}
+
+func (m *merger[V]) both(a, b *gnode[V]) gnode[V] {
+	if m.resolve == nil {
+		return *a
+	}
+	return m.resolve(a, b)
+}
+
+// branch returns a branch at index with the given twigs, or the only twig, or
+// a nil node if there are none.
+func (m *merger[V]) branch(index nibbleIndexT, bitmap bitmapT, kept []gnode[V]) gnode[V] {
+	switch len(kept) {
+	case 0:
+		return gnode[V]{}
+	case 1:
+		return kept[0]
+	}
+	twigs := m.pool.get(len(kept))
+	copy(twigs, kept)
+	var r gnode[V]
+	r.setBranch(twigs, index, bitmap)
+	return r
+}
+
+// pair returns a branch at index holding the disjoint subtrees a and b.
+func (m *merger[V]) pair(index nibbleIndexT, a, b *gnode[V], ka, kb []byte) gnode[V] {
+	ba, bb := nibbleBit(index, ka), nibbleBit(index, kb)
+	twigs := m.pool.get(2)
+	if ba < bb {
+		twigs[0], twigs[1] = adopt(a), adopt(b)
+	} else {
+		twigs[0], twigs[1] = adopt(b), adopt(a)
+	}
+	var r gnode[V]
+	r.setBranch(twigs, index, ba|bb)
+	return r
+}
+
+// union returns the keys of a and b.
+func (m *merger[V]) union(a, b *gnode[V]) gnode[V] {
+	if m.resolve == nil && sameSubtree(a, b) {
+		m.common += countLeaves(a)
+		return adopt(a)
+	}
+	ka, kb := a.firstLeaf().key(), b.firstLeaf().key()
+	ia, ib, d := a.splitIndex(), b.splitIndex(), divergeIndex(ka, kb)
+	switch {
+	case d < ia && d < ib:
+		return m.pair(d, a, b, ka, kb)
+	case ia < ib:
+		return m.unionInto(a, b, nibbleBit(ia, kb), true)
+	case ib < ia:
+		return m.unionInto(b, a, nibbleBit(ib, ka), false)
+	case !a.isBranch():
+		m.common++
+		return m.both(a, b)
+	}
+
+	bitmap := a.bitmap() | b.bitmap()
+	twigs := m.pool.get(bits.OnesCount32(bitmap))
+	for i, rest := 0, bitmap; rest != 0; i++ {
+		bit := rest & -rest
+		rest &^= bit
+		switch {
+		case !b.hasTwig(bit):
+			twigs[i] = adopt(a.twig(a.twigOffset(bit)))
+		case !a.hasTwig(bit):
+			twigs[i] = adopt(b.twig(b.twigOffset(bit)))
+		default:
+			twigs[i] = m.union(a.twig(a.twigOffset(bit)), b.twig(b.twigOffset(bit)))
+		}
+	}
+	var r gnode[V]
+	r.setBranch(twigs, ia, bitmap)
+	return r
+}
+
+// unionInto returns the union of the branch br and n, whose keys all fall into
+// the twig b of br. brFirst tells which of them is the first trie.
+func (m *merger[V]) unionInto(br, n *gnode[V], b bitmapT, brFirst bool) gnode[V] {
+	old := br.twigs()
+	off := br.twigOffset(b)
+	var twigs []gnode[V]
+	if br.hasTwig(b) {
+		twigs = m.pool.get(len(old))
+		copyTwigs(twigs, old, true)
+		if brFirst {
+			twigs[off] = m.union(&old[off], n)
+		} else {
+			twigs[off] = m.union(n, &old[off])
+		}
+	} else {
+		twigs = m.pool.get(len(old) + 1)
+		copyTwigs(twigs[:off], old[:off], true)
+		twigs[off] = adopt(n)
+		copyTwigs(twigs[off+1:], old[off:], true)
+	}
+	var r gnode[V]
+	r.setBranch(twigs, br.index(), br.bitmap()|b)
+	return r
+}
+
+// intersect returns the keys of a that are also in b, and their number.
+func (m *merger[V]) intersect(a, b *gnode[V]) (gnode[V], int) {
+	if m.resolve == nil && sameSubtree(a, b) {
+		return adopt(a), countLeaves(a)
+	}
+	ka, kb := a.firstLeaf().key(), b.firstLeaf().key()
+	ia, ib, d := a.splitIndex(), b.splitIndex(), divergeIndex(ka, kb)
+	switch {
+	case d < ia && d < ib:
+		return gnode[V]{}, 0
+	case ia < ib:
+		bit := nibbleBit(ia, kb)
+		if !a.hasTwig(bit) {
+			return gnode[V]{}, 0
+		}
+		return m.intersect(a.twig(a.twigOffset(bit)), b)
+	case ib < ia:
+		bit := nibbleBit(ib, ka)
+		if !b.hasTwig(bit) {
+			return gnode[V]{}, 0
+		}
+		return m.intersect(a, b.twig(b.twigOffset(bit)))
+	case !a.isBranch():
+		return m.both(a, b), 1
+	}
+
+	var kept [maxTwigs]gnode[V]
+	var keptBits bitmapT
+	n, total := 0, 0
+	for rest := a.bitmap() & b.bitmap(); rest != 0; {
+		bit := rest & -rest
+		rest &^= bit
+		r, c := m.intersect(a.twig(a.twigOffset(bit)), b.twig(b.twigOffset(bit)))
+		if c > 0 {
+			kept[n] = r
+			keptBits |= bit
+			n++
+			total += c
+		}
+	}
+	return m.branch(ia, keptBits, kept[:n]), total
+}
+
+// difference returns the keys of a that are not in b, and how many keys of a
+// it left out.
+func (m *merger[V]) difference(a, b *gnode[V]) (gnode[V], int) {
+	if sameSubtree(a, b) {
+		return gnode[V]{}, countLeaves(a)
+	}
+	ka, kb := a.firstLeaf().key(), b.firstLeaf().key()
+	ia, ib, d := a.splitIndex(), b.splitIndex(), divergeIndex(ka, kb)
+	switch {
+	case d < ia && d < ib:
+		return adopt(a), 0
+	case ib < ia:
+		bit := nibbleBit(ib, ka)
+		if !b.hasTwig(bit) {
+			return adopt(a), 0
+		}
+		return m.difference(a, b.twig(b.twigOffset(bit)))
+	case !a.isBranch():
+		return gnode[V]{}, 1
+	}
+
+	// a branches first, or both branch at the same index.
+	var kept [maxTwigs]gnode[V]
+	var keptBits bitmapT
+	n, removed := 0, 0
+	for rest := a.bitmap(); rest != 0; {
+		bit := rest & -rest
+		rest &^= bit
+		t := a.twig(a.twigOffset(bit))
+		r, c := adopt(t), 0
+		switch {
+		case ia == ib && b.hasTwig(bit):
+			r, c = m.difference(t, b.twig(b.twigOffset(bit)))
+		case ia < ib && bit == nibbleBit(ia, kb):
+			r, c = m.difference(t, b)
+		}
+		removed += c
+		if !r.isNil() {
+			kept[n] = r
+			keptBits |= bit
+			n++
+		}
+	}
+	if removed == 0 {
+		return adopt(a), 0
+	}
+	return m.branch(ia, keptBits, kept[:n]), removed
+}
+
+// subset reports whether every key of a is in b.
+func subset[V any](a, b *gnode[V]) bool {
+	if sameSubtree(a, b) {
+		return true
+	}
+	ka, kb := a.firstLeaf().key(), b.firstLeaf().key()
+	ia, ib, d := a.splitIndex(), b.splitIndex(), divergeIndex(ka, kb)
+	switch {
+	case d < ia && d < ib:
+		return false
+	case ia < ib:
+		// a has keys in at least two twigs at ia, b in only one.
+		return false
+	case ib < ia:
+		bit := nibbleBit(ib, ka)
+		return b.hasTwig(bit) && subset(a, b.twig(b.twigOffset(bit)))
+	case !a.isBranch():
+		return true
+	}
+
+	if a.bitmap()&^b.bitmap() != 0 {
+		return false
+	}
+	for rest := a.bitmap(); rest != 0; {
+		bit := rest & -rest
+		rest &^= bit
+		if !subset(a.twig(a.twigOffset(bit)), b.twig(b.twigOffset(bit))) {
+			return false
+		}
+	}
+	return true
+}
+
+// inherit gives tr, an empty trie, a key arena and a node pool of its own if
+// o has them.
+func (tr *trie[V]) inherit(o *trie[V]) {
+	if o.arena != nil {
+		tr.arena = &keyArena{}
+	}
+	if o.pool != nil {
+		tr.pool = &twigPool[V]{}
+	}
+}
+
+// derive returns an empty trie with the options of tr.
+func (tr *Trie) derive() *Trie {
+	res := &Trie{onInsert: tr.onInsert, onUpdate: tr.onUpdate}
+	res.inherit(&tr.trie)
+	res.initHandlers()
+	return res
+}
+
+// union returns a trie with the keys of tr and o, sharing their nodes.
+// For keys in both, resolve picks the leaf; nil keeps the one of tr.
+func (tr *Trie) union(o *Trie, resolve func(a, b *node) node) *Trie {
+	res := tr.derive()
+	res.unionOf(&tr.trie, &o.trie, resolve)
+	return res
+}
+
+// unionOf makes tr, an empty trie, hold the keys of a and b, sharing their
+// nodes. For keys in both, resolve picks the leaf; nil keeps the one of a.
+func (tr *trie[V]) unionOf(a, b *trie[V], resolve func(x, y *gnode[V]) gnode[V]) {
+	a.share()
+	b.share()
+	switch {
+	case b.root.isNil():
+		tr.root, tr.size = adopt(&a.root), a.size
+	case a.root.isNil():
+		tr.root, tr.size = adopt(&b.root), b.size
+	default:
+		m := merger[V]{pool: tr.pool, resolve: resolve}
+		tr.root = m.union(&a.root, &b.root)
+		tr.size = a.size + b.size - m.common
+	}
+}
+
+// intersectOf makes tr, an empty trie, hold the keys of a that are also in b.
+func (tr *trie[V]) intersectOf(a, b *trie[V]) {
+	if a.root.isNil() || b.root.isNil() {
+		return
+	}
+	a.share()
+	b.share()
+	m := merger[V]{pool: tr.pool}
+	tr.root, tr.size = m.intersect(&a.root, &b.root)
+}
+
+// differenceOf makes tr, an empty trie, hold the keys of a that are not in b.
+func (tr *trie[V]) differenceOf(a, b *trie[V]) {
+	a.share()
+	if a.root.isNil() || b.root.isNil() {
+		tr.root, tr.size = adopt(&a.root), a.size
+		return
+	}
+	b.share()
+	m := merger[V]{pool: tr.pool}
+	var removed int
+	tr.root, removed = m.difference(&a.root, &b.root)
+	tr.size = a.size - removed
+}
+
+// subset reports whether every key of tr is in o.
+func (tr *trie[V]) subset(o *trie[V]) bool {
+	switch {
+	case tr.root.isNil():
+		return true
+	case o.root.isNil():
+		return false
+	}
+	return subset(&tr.root, &o.root)
+}
@@ -0,0 +1,76 @@
+package qp
+
+const (
+	arenaChunkSize = 64 << 10
+	// keys longer than this get a chunk of their own
+	arenaMaxInline = arenaChunkSize / 8
+	// compaction is not worth it below this many bytes
+	arenaMinCompact = 1 << 20
+)
+
+// keyArena copies keys into large append-only chunks, so the trie owns its key
+// bytes and the GC sees a few chunks instead of one object per key.
+// Chunks are never written behind a key that has been handed out.
+type keyArena struct {
+	cur  []byte // current chunk, appended to until full
+	used int    // bytes of keys handed out since the last compaction
+	dead int    // bytes of those keys that were deleted since
+}
+
+func (a *keyArena) alloc(key []byte) []byte {
+	k := a.reserve(len(key))
+	copy(k, key)
+	return k
+}
+
+// reserve returns n bytes for a key that the caller fills in.
+func (a *keyArena) reserve(n int) []byte {
+	a.used += n
+	if n > arenaMaxInline {
+		return make([]byte, n)
+	}
+	if cap(a.cur)-len(a.cur) < n {
+		a.cur = make([]byte, 0, arenaChunkSize)
+	}
+	start := len(a.cur)
+	a.cur = a.cur[:start+n]
+	return a.cur[start:len(a.cur):len(a.cur)]
+}
+
+func (a *keyArena) free(key []byte) {
+	a.dead += len(key)
+}
+
+// needCompact reports whether deleted keys pin at least half of the arena.
+func (a *keyArena) needCompact() bool {
+	return a.used >= arenaMinCompact && a.dead*2 >= a.used
+}
+
+// clone returns an arena for a trie that starts out sharing the keys of a,
+// without sharing the chunk a is appending to.
+func (a *keyArena) clone() *keyArena {
+	return &keyArena{used: a.used, dead: a.dead}
+}
+
+// compactKeys copies every key into a fresh arena, releasing chunks that were
+// kept alive by a few surviving keys. Shared branches are copied on the way,
+// so snapshots keep their keys.
+func (tr *trie[V]) compactKeys() {
+	tr.own()
+	tr.arena = &keyArena{}
+	if !tr.root.isNil() {
+		tr.compactNode(&tr.root)
+	}
+}
+
+func (tr *trie[V]) compactNode(n *gnode[V]) {
+	if !n.isBranch() {
+		n.setLeaf(tr.arena.alloc(n.key()), n.val)
+		return
+	}
+	n.unshare(tr.pool)
+	twigs := n.twigs()
+	for i := range twigs {
+		tr.compactNode(&twigs[i])
+	}
+}
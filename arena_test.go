@@ -0,0 +1,83 @@
+package qp
+
+import (
+	"fmt"
+	"testing"
+)
+
+func Test_KeyArenaOwnsKeys(t *testing.T) {
+	tr := New(WithKeyArena())
+	buf := make([]byte, 0, 16)
+	for i := 0; i < 1000; i++ {
+		buf = fmt.Appendf(buf[:0], "key-%d", i)
+		tr.Upsert(buf, i)
+	}
+	for i := 0; i < 1000; i++ {
+		val, found := tr.Get([]byte(fmt.Sprintf("key-%d", i)))
+		if !found || val.(int) != i {
+			t.Fatalf("key-%d got %v, %v", i, val, found)
+		}
+	}
+
+	long := make([]byte, arenaMaxInline+1)
+	for i := range long {
+		long[i] = 'x'
+	}
+	tr.Upsert(long, -1)
+	long[0] = 'y'
+	if _, found := tr.Get(long); found {
+		t.Fatalf("modified long key should not be found")
+	}
+	long[0] = 'x'
+	if val, found := tr.Get(long); !found || val.(int) != -1 {
+		t.Fatalf("long key got %v, %v", val, found)
+	}
+}
+
+func Test_KeyArenaCompact(t *testing.T) {
+	words := loadTestData(wordsPath)
+	tr := New(WithKeyArena())
+	m := make(map[string]any)
+	for i, w := range words {
+		tr.Upsert(w, i)
+		m[string(w)] = i
+	}
+	snapshot := make(map[string]any, len(m))
+	for k, v := range m {
+		snapshot[k] = v
+	}
+	tx := tr.Txn()
+
+	compacted := false
+	for i, w := range words {
+		if i%4 == 0 {
+			continue
+		}
+		usedBefore := tx.newTr.arena.used
+		tx.Delete(w)
+		delete(m, string(w))
+		if tx.newTr.arena.used < usedBefore {
+			compacted = true
+		}
+	}
+	if !compacted {
+		t.Fatalf("arena was never compacted")
+	}
+	if tx.newTr.arena.dead*2 >= tx.newTr.arena.used {
+		t.Fatalf("arena used %d, dead %d after deletes", tx.newTr.arena.used, tx.newTr.arena.dead)
+	}
+
+	checkTrie(t, tx.oldTr, snapshot)
+	checkTrie(t, tx.Commit(), m)
+}
+
+func Benchmark_Words_Upsert_KeyArena(b *testing.B) {
+	words := loadTestData(wordsPath)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr := New(WithKeyArena())
+		for _, w := range words {
+			tr.Upsert(w, w)
+		}
+	}
+}
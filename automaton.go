@@ -0,0 +1,182 @@
+package qp
+
+import "math/bits"
+
+// Automaton is a deterministic automaton over key bytes, as used by
+// SearchAutomaton. States are ints chosen by the automaton.
+type Automaton interface {
+	// Start returns the state before the first byte of a key.
+	Start() int
+	// Step returns the state after b.
+	Step(state int, b byte) int
+	// IsMatch reports whether a key ending in state is accepted.
+	IsMatch(state int) bool
+	// CanMatch reports whether any key continuing from state can be accepted.
+	// Returning true for a dead state is allowed but wastes work.
+	CanMatch(state int) bool
+}
+
+// SearchAutomaton returns up to limit pairs, in key order, whose keys a
+// accepts. The automaton is stepped over the bytes shared by a subtree once,
+// and subtrees are abandoned as soon as it reaches a state that cannot match.
+func (tr *Trie) SearchAutomaton(a Automaton, limit int) []KVPair {
+	var pairs []KVPair
+	tr.searchAutomaton(a, limit, func(leaf *node, _ int) {
+		pairs = append(pairs, KVPair{Key: leaf.key(), Value: leaf.val})
+	})
+	return pairs
+}
+
+// searchAutomaton calls add, in key order, for up to limit leaves whose keys a
+// accepts, with the state the key leads to.
+func (tr *Trie) searchAutomaton(a Automaton, limit int, add func(leaf *node, state int)) {
+	if tr.root.isNil() || limit <= 0 {
+		return
+	}
+	s := automatonSearch{a: a, limit: limit, add: add}
+	s.nibbles, _ = a.(nibbleAutomaton)
+	if state := a.Start(); a.CanMatch(state) {
+		s.search(&tr.root, 0, state)
+	}
+}
+
+// nibbleAutomaton is an Automaton that knows the high nibbles of the bytes
+// that can be read from a state, so twigs at even indexes can be skipped
+// before their byte is complete.
+type nibbleAutomaton interface {
+	Automaton
+	highNibbles(state int) uint16
+}
+
+type automatonSearch struct {
+	a       Automaton
+	nibbles nibbleAutomaton // a, if it is one
+	limit   int
+	found   int
+	add     func(leaf *node, state int)
+}
+
+// search adds the accepted keys under n, whose first pos bytes led to state,
+// and reports whether the limit was reached.
+func (s *automatonSearch) search(n *node, pos int, state int) bool {
+	key := n.firstLeaf().key()
+	end := len(key)
+	if n.isBranch() {
+		end = int(n.index() / 2)
+	}
+	for ; pos < end; pos++ {
+		state = s.a.Step(state, key[pos])
+		if !s.a.CanMatch(state) {
+			return false
+		}
+	}
+
+	if !n.isBranch() {
+		if s.a.IsMatch(state) {
+			s.add(n, state)
+			s.found++
+		}
+		return s.found == s.limit
+	}
+
+	odd := n.index()&1 == 1
+	var hi uint16
+	if !odd && s.nibbles != nil {
+		hi = s.nibbles.highNibbles(state)
+	}
+	for rest := n.bitmap(); rest != 0; {
+		bit := rest & -rest
+		rest &^= bit
+		nibble := byte(bits.TrailingZeros32(bit) - 1)
+		twigPos, twigState := pos, state
+		switch {
+		case odd:
+			// The twig's nibble completes the byte at pos.
+			twigState = s.a.Step(state, key[pos]&0xf0|nibble)
+			if !s.a.CanMatch(twigState) {
+				continue
+			}
+			twigPos++
+		case bit > 1 && s.nibbles != nil && hi&(1<<nibble) == 0:
+			continue
+		}
+		if s.search(n.twig(n.twigOffset(bit)), twigPos, twigState) {
+			return true
+		}
+	}
+	return false
+}
+
+// dfaCache keeps the states and transitions of an automaton that is built
+// lazily, one state at a time. Bytes that no state tells apart share a class,
+// and a state keeps one transition per class.
+type dfaCache struct {
+	class  [256]uint8
+	nclass int
+	index  map[string]int
+	next   []int32 // by state and class: the next state+1, or 0 if not computed yet
+}
+
+// init sets up the byte classes, which no set in sets has some but not all
+// bytes of. With nil sets every byte has a class of its own.
+func (c *dfaCache) init(sets []byteSet) {
+	c.index = map[string]int{}
+	if sets == nil {
+		for b := range 256 {
+			c.class[b] = uint8(b)
+		}
+		c.nclass = 256
+		return
+	}
+	c.nclass = 1
+	for i := range sets {
+		// Split each class into its bytes in sets[i] and the rest.
+		var ids [512]int16 // by old class and membership: new class+1
+		n := 0
+		for b := range 256 {
+			k := 2 * int(c.class[b])
+			if sets[i].has(byte(b)) {
+				k++
+			}
+			if ids[k] == 0 {
+				n++
+				ids[k] = int16(n)
+			}
+			c.class[b] = uint8(ids[k] - 1)
+		}
+		c.nclass = n
+	}
+}
+
+// intern returns the state named key and whether it was just created.
+// States are numbered from 0 in the order they are created.
+func (c *dfaCache) intern(key string) (state int, added bool) {
+	if id, ok := c.index[key]; ok {
+		return id, false
+	}
+	id := len(c.next) / c.nclass
+	c.next = append(c.next, make([]int32, c.nclass)...)
+	c.index[key] = id
+	return id, true
+}
+
+// cached returns the state after b, if it has been computed.
+func (c *dfaCache) cached(state int, b byte) (int, bool) {
+	next := c.next[state*c.nclass+int(c.class[b])]
+	return int(next) - 1, next > 0
+}
+
+func (c *dfaCache) set(state int, b byte, next int) {
+	c.next[state*c.nclass+int(c.class[b])] = int32(next + 1)
+}
+
+// byteSet is a set of bytes.
+type byteSet [4]uint64
+
+func (s *byteSet) has(b byte) bool {
+	return s[b>>6]&(1<<(b&63)) != 0
+}
+
+func (s *byteSet) add(b byte) {
+	s[b>>6] |= 1 << (b & 63)
+}
@@ -0,0 +1,106 @@
+package qp
+
+import (
+	"math/rand"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func Test_SearchAutomaton(t *testing.T) {
+	tr := New()
+	for _, k := range []string{"user:1:session", "user:22:session", "user:x:session", "user:1:profile", "héllo", "hello", "h\xffllo"} {
+		tr.Upsert([]byte(k), k)
+	}
+	tests := []struct {
+		expr  string
+		limit int
+		keys  []string
+	}{
+		{`user:\d+:session`, 10, []string{"user:1:session", "user:22:session"}},
+		{`user:\d+:session`, 1, []string{"user:1:session"}},
+		{`h.llo`, 10, []string{"hello", "héllo", "h\xffllo"}},
+		{`h[^e]llo`, 10, []string{"héllo", "h\xffllo"}},
+		{`h\x{FFFD}llo`, 10, []string{"h\xffllo"}},
+		{`(?i)HÉLLO`, 10, []string{"héllo"}},
+		{`^user:(1|x):.*$`, 10, []string{"user:1:profile", "user:1:session", "user:x:session"}},
+		{`user`, 10, nil},
+		{`.*`, 0, nil},
+	}
+	for _, tt := range tests {
+		a, err := CompileRegexp(tt.expr)
+		if err != nil {
+			t.Fatalf("CompileRegexp(%q): %v", tt.expr, err)
+		}
+		var keys []string
+		for _, p := range tr.SearchAutomaton(a, tt.limit) {
+			keys = append(keys, string(p.Key))
+		}
+		if !slices.Equal(keys, tt.keys) {
+			t.Errorf("SearchAutomaton(%q, %d) got %q want %q", tt.expr, tt.limit, keys, tt.keys)
+		}
+	}
+
+	for _, expr := range []string{`(`, `\bx`, `(?m)^x`} {
+		if _, err := CompileRegexp(expr); err == nil {
+			t.Errorf("CompileRegexp(%q) succeeded", expr)
+		}
+	}
+}
+
+func Test_SearchAutomatonRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	pieces := []string{"a", "b", "é", "\xc3", "\xa9", "\xff"}
+	tr := New()
+	var keys []string
+	for range 400 {
+		var k string
+		for range 1 + r.Intn(5) {
+			k += pieces[r.Intn(len(pieces))]
+		}
+		if _, isUpdate := tr.Upsert([]byte(k), nil); !isUpdate {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	exprs := []string{
+		`a*`, `(a|b)*é`, `.*b`, `..`, `[^a]+`, `a?b?.`, `\x{FFFD}.*`, `(?:ab|é)+$`,
+		`.é*.`, `(a|)*b`, `^a.*$`, `(?s).{2,3}`, `[a-é]+`, `(?i)A+B`, `é?\x{FFFD}+`,
+	}
+	for _, expr := range exprs {
+		re := regexp.MustCompile(`^(?:` + expr + `)$`)
+		var want []string
+		for _, k := range keys {
+			if re.MatchString(k) {
+				want = append(want, k)
+			}
+		}
+		a, err := CompileRegexp(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, p := range tr.SearchAutomaton(a, len(keys)) {
+			got = append(got, string(p.Key))
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%q: got %q want %q", expr, got, want)
+		}
+	}
+}
+
+func Benchmark_Words_SearchAutomaton(b *testing.B) {
+	tr := New()
+	for _, w := range loadTestData(wordsPath) {
+		tr.Upsert(w, nil)
+	}
+	a, err := CompileRegexp(`qu[a-z]c.*ly`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		tr.SearchAutomaton(a, 100)
+	}
+}
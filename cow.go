@@ -1,7 +1,5 @@
 package qp
 
-import "bytes"
-
 type Txn struct {
 	oldTr *Trie
 	newTr *Trie
@@ -10,22 +8,51 @@ type Txn struct {
 // Txn creates a new transaction for the Trie. It returns a transaction object
 // that provides copy-on-write functionality for modifying the trie. The original
 // trie remains unchanged until the transaction is committed.
+//
+// Both tries share their nodes afterwards, and whichever is modified first
+// copies the nodes on the modified path and leaves the other one intact.
+// Txn only reads tr, so it may run alongside other readers of tr.
 func (tr *Trie) Txn() *Txn {
 	var tx Txn
-	tx.newTr = &Trie{
-		root:     tr.root,
-		size:     tr.size,
-		onInsert: tr.onInsert,
-		onUpdate: tr.onUpdate,
-	}
-	if tr.root != nil {
-		tx.newTr.root.markCow()
-	}
-
+	tx.newTr = tr.snapshot()
 	tx.oldTr = tr
 	return &tx
 }
 
+// snapshot returns a trie sharing all nodes with tr. Its root is marked as
+// shared, and tr marks its own before it is next modified, so either can be
+// modified without affecting the other.
+func (tr *Trie) snapshot() *Trie {
+	newTr := &Trie{onInsert: tr.onInsert, onUpdate: tr.onUpdate}
+	newTr.snapshotOf(&tr.trie)
+	return newTr
+}
+
+// snapshotOf makes tr, an empty trie, share all nodes with o.
+func (tr *trie[V]) snapshotOf(o *trie[V]) {
+	o.share()
+	tr.root, tr.size, tr.pool = adopt(&o.root), o.size, o.pool
+	if o.arena != nil {
+		tr.arena = o.arena.clone()
+	}
+}
+
+// share records that the nodes of tr are now also reachable from another
+// trie. Marking the root would be a write readers of tr could race with, so
+// only a flag is set, and own does the marking.
+func (tr *trie[V]) share() {
+	tr.shared.Store(true)
+}
+
+// own marks the root of tr as shared if share was called since tr was last
+// modified. Methods modifying the nodes of tr in place call it first.
+func (tr *trie[V]) own() {
+	if tr.shared.Load() {
+		tr.root.markCow()
+		tr.shared.Store(false)
+	}
+}
+
 // Commit finalizes the transaction by setting the old trie to the new trie
 // and clearing the new trie reference. Returns the committed trie.
 func (tx *Txn) Commit() *Trie {
@@ -36,7 +63,11 @@ func (tx *Txn) Commit() *Trie {
 
 // Abort cancels the transaction and returns the original trie state.
 // Any changes made during the transaction will be discarded.
+// With WithNodePool, the nodes the transaction copied are reused.
 func (tx *Txn) Abort() *Trie {
+	if tx.newTr != nil && tx.newTr.pool != nil {
+		tx.newTr.pool.recycle(&tx.newTr.root)
+	}
 	tx.newTr = nil
 	return tx.oldTr
 }
@@ -52,138 +83,12 @@ func (tx *Txn) Get(key []byte) (val any, found bool) {
 // whether it was an update operation. For new insertions, it returns nil and false.
 // The key must not be nil.
 func (tx *Txn) Upsert(key []byte, value any) (oldVal any, isUpdate bool) {
-	must(key)
-
-	if tx.newTr.root == nil {
-		tx.newTr.root = &leafNode{key: key, value: tx.newTr.onInsert(value), cow: false}
-		tx.newTr.size++
-		return nil, false
-	}
-
-	leaf := tx.newTr.findMatch(key, false)
-	index, exactMatch := nibbleIndex(key, leaf.key)
-	if exactMatch {
-		oldVal = leaf.value
-	}
-	ptr, growBranch := tx.findInsert(key, index, exactMatch)
-	if exactMatch {
-		lf := (*ptr).(*leafNode)
-		lf.value = tx.newTr.onUpdate(value, oldVal)
-		return oldVal, true
-	}
-
-	newLeaf := &leafNode{key: key, value: tx.newTr.onInsert(value), cow: false}
-	if growBranch {
-		bn := (*ptr).(*branchNode)
-		bn.growTwigs(index, key, newLeaf)
-	} else {
-		bn := newBranchNode(*ptr, index, leaf.key, key, newLeaf)
-		*ptr = bn
-	}
-
-	tx.newTr.size++
-	return nil, false
-}
-
-func (tx *Txn) findInsert(key []byte, index nibbleIndexT, exactMatch bool) (ptr *trieNode, growBranch bool) {
-	ptr = &tx.newTr.root
-	for {
-		switch n := (*ptr).(type) {
-		case *leafNode:
-			if n.cowMarked() {
-				n.clearCow()
-				newLf := n.dup()
-				*ptr = newLf
-			}
-			return ptr, false
-		case *branchNode:
-			if n.cowMarked() {
-				n.markTwigs()
-				n.clearCow()
-				newBn := n.dup()
-				*ptr = newBn
-				n = newBn.(*branchNode)
-			}
-			if !exactMatch {
-				if index == n.index {
-					return ptr, true
-				}
-				if index < n.index {
-					return ptr, false
-				}
-			}
-
-			i := 0
-			b := n.twigBit(key)
-			if n.hasTwig(b) {
-				i = n.twigOffset(b)
-			}
-			ptr = n.twig(i)
-		}
-	}
-}
-
-func (tx *Txn) findDelete(key []byte) (parentBn *trieNode, leaf *leafNode, b bitmapT) {
-	ptr := &tx.newTr.root
-	for {
-		switch n := (*ptr).(type) {
-		case *leafNode:
-			if n.cowMarked() {
-				n.clearCow()
-				newLf := n.dup()
-				*ptr = newLf
-			}
-			return parentBn, n, b
-		case *branchNode:
-			if n.cowMarked() {
-				n.markTwigs()
-				n.clearCow()
-				newBn := n.dup()
-				*ptr = newBn
-				n = newBn.(*branchNode)
-			}
-			b = n.twigBit(key)
-			if !n.hasTwig(b) {
-				return nil, nil, 0
-			}
-			i := n.twigOffset(b)
-			parentBn = ptr
-			ptr = n.twig(i)
-		}
-	}
+	return tx.newTr.Upsert(key, value)
 }
 
 // Delete removes the entry for the given key from the transaction.
 // It returns the old value and true if the key was present, or nil and false if not found.
 // The key must not be nil.
 func (tx *Txn) Delete(key []byte) (oldVal any, found bool) {
-	must(key)
-
-	if tx.newTr.root == nil {
-		return nil, false
-	}
-
-	parentBn, leaf, b := tx.findDelete(key)
-	if leaf == nil || !bytes.Equal(key, leaf.key) {
-		return nil, false
-	}
-	tx.newTr.size--
-	if parentBn == nil {
-		tx.newTr.root = nil
-		return leaf.value, true
-	}
-
-	bn := (*parentBn).(*branchNode)
-	if bn.twigOffsetMax() == 2 {
-		other := 0
-		if bn.twigOffset(b) == 0 {
-			other = 1
-		}
-		otherTwig := bn.twig(other)
-		*parentBn = *otherTwig
-		return leaf.value, true
-	}
-
-	bn.removeTwig(b)
-	return leaf.value, true
+	return tx.newTr.Delete(key)
 }
@@ -1,7 +1,9 @@
 package qp
 
 import (
+	"bytes"
 	"math"
+	"math/rand"
 	"reflect"
 	"testing"
 )
@@ -360,3 +362,131 @@ func Test_CowAbort(t *testing.T) {
 		})
 	}
 }
+
+func Test_CowAfterDelete(t *testing.T) {
+	tr := New()
+	for _, k := range []string{"a", "b", "c"} {
+		tr.Upsert([]byte(k), value1)
+	}
+	tr.Delete([]byte("b"))
+
+	tx := tr.Txn()
+	tx.Upsert([]byte("d"), value2)
+	tr = tx.Commit()
+
+	expect := []KVPair{
+		{[]byte("a"), value1},
+		{[]byte("c"), value1},
+		{[]byte("d"), value2},
+	}
+	if result := tr.Walk(math.MaxInt, nil); !reflect.DeepEqual(result, expect) {
+		t.Errorf("Walk got %v want %v", result, expect)
+	}
+}
+
+func Test_CowIsolation(t *testing.T) {
+	words := loadTestData(wordsPath)[:20000]
+	rd := rand.New(rand.NewSource(1))
+
+	tr := New()
+	oldM := make(map[string]any)
+	for _, w := range words[:10000] {
+		tr.Upsert(w, value1)
+		oldM[string(w)] = value1
+	}
+	newM := make(map[string]any, len(oldM))
+	for k, v := range oldM {
+		newM[k] = v
+	}
+
+	tx := tr.Txn()
+	for i := 0; i < 20000; i++ {
+		w := words[rd.Intn(len(words))]
+		if rd.Intn(3) == 0 {
+			tx.Delete(w)
+			delete(newM, string(w))
+		} else {
+			tx.Upsert(w, i)
+			newM[string(w)] = i
+		}
+	}
+	// Writing to the old trie directly must not leak into the transaction either.
+	for i := 0; i < 2000; i++ {
+		w := words[rd.Intn(len(words))]
+		tr.Upsert(w, -i)
+		oldM[string(w)] = -i
+	}
+
+	checkTrie(t, tx.oldTr, oldM)
+	checkTrie(t, tx.Commit(), newM)
+}
+
+func checkTrie(t *testing.T, tr *Trie, m map[string]any) {
+	t.Helper()
+	if err := tr.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if tr.Size() != len(m) {
+		t.Fatalf("Size got %d want %d", tr.Size(), len(m))
+	}
+	for k, v := range m {
+		got, found := tr.Get([]byte(k))
+		if !found || got != v {
+			t.Fatalf("Get(%q) got %v, %v want %v", k, got, found, v)
+		}
+	}
+	n := 0
+	var prev []byte
+	it := tr.Iterator()
+	for {
+		k, _, ok := it.Next()
+		if !ok {
+			break
+		}
+		if prev != nil && bytes.Compare(prev, k) >= 0 {
+			t.Fatalf("keys out of order: %q, %q", prev, k)
+		}
+		prev = k
+		n++
+	}
+	if n != len(m) {
+		t.Fatalf("iterated %d keys want %d", n, len(m))
+	}
+}
+
+func Test_CowTxnConcurrentGet(t *testing.T) {
+	tr := New()
+	words := loadTestData(wordsPath)[:2000]
+	for _, w := range words {
+		tr.Upsert(w, value1)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, w := range words {
+			if _, found := tr.Get(w); !found {
+				t.Errorf("Get(%q) not found", w)
+				return
+			}
+		}
+	}()
+	// Starting transactions and set operations only reads tr.
+	for i := 0; i < 100; i++ {
+		tx := tr.Txn()
+		tx.Upsert(words[i], value2)
+		tx.Commit()
+		tr.union(tr, nil)
+		tr.Split(words[i])
+	}
+	<-done
+
+	tr.Upsert(words[0], value2)
+	tx := tr.Txn()
+	tx.Delete(words[1])
+	if _, found := tr.Get(words[1]); !found {
+		t.Fatalf("Delete in a transaction changed the trie")
+	}
+	if v, _ := tx.Get(words[0]); v != value2 {
+		t.Fatalf("Get in a transaction got %v want %v", v, value2)
+	}
+}
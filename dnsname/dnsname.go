@@ -0,0 +1,152 @@
+// Package dnsname stores values by domain name in a qp trie, ordered the way
+// DNSSEC orders names, with the lookups an authoritative server needs to
+// build answers and denial-of-existence proofs.
+//
+// Names are stored label-reversed and case-folded (see Name), so byte order of
+// keys is canonical order (RFC 4034, section 6.1) and all names at or below a
+// node of the DNS tree share a key prefix.
+package dnsname
+
+import (
+	"bytes"
+
+	"github.com/gnosnah/qp"
+)
+
+var wildcardLabel = []byte("*")
+
+// Table maps domain names to values.
+// A Table is not safe for concurrent writers.
+type Table struct {
+	tr *qp.Trie
+}
+
+// New creates an empty table.
+func New() *Table {
+	return &Table{tr: qp.New()}
+}
+
+// Size returns the number of names in the table.
+func (t *Table) Size() int {
+	return t.tr.Size()
+}
+
+// Insert stores val for n, replacing and returning any previous value.
+func (t *Table) Insert(n Name, val any) (oldVal any, isUpdate bool) {
+	return t.tr.Upsert(n.trieKey(), val)
+}
+
+// Delete removes n, returning its value.
+func (t *Table) Delete(n Name) (oldVal any, found bool) {
+	return t.tr.Delete(n.trieKey())
+}
+
+// Get returns the value stored for exactly n.
+func (t *Table) Get(n Name) (val any, found bool) {
+	return t.tr.Get(n.trieKey())
+}
+
+// Exists reports whether n is in the table or is an empty non-terminal, that
+// is, an ancestor of a name in the table.
+func (t *Table) Exists(n Name) bool {
+	key := n.trieKey()
+	it := t.tr.Iterator()
+	it.Seek(key)
+	k, _, ok := it.Next()
+	return ok && bytes.HasPrefix(k, key)
+}
+
+// ClosestEncloser returns the longest ancestor of n, or n itself, that exists
+// in the table, counting empty non-terminals as existing (RFC 4592, section
+// 3.3.1). found reports whether that name itself holds a value. The root
+// always encloses n, so an empty table returns the root.
+func (t *Table) ClosestEncloser(n Name) (ce Name, val any, found bool) {
+	// Any name below an ancestor of n sorts between that ancestor and the
+	// ancestor's successor, so the deepest one shares the longest label
+	// aligned prefix with n's neighbours in canonical order.
+	key := n.trieKey()
+	l := 0
+	if k, _, _ := t.tr.GetLessOrEqual(key); k != nil {
+		l = commonLabels(key, k)
+	}
+	it := t.tr.Iterator()
+	it.Seek(key)
+	if k, _, ok := it.Next(); ok {
+		l = max(l, commonLabels(key, k))
+	}
+	ce = Name{key: key[:max(l, 1)]}
+	val, found = t.tr.Get(ce.key)
+	return ce, val, found
+}
+
+// Lookup returns the value for n, or if n does not exist, the value of the
+// wildcard at its closest encloser that synthesizes it (RFC 4592). source is
+// the name the value was found under.
+func (t *Table) Lookup(n Name) (source Name, val any, found bool) {
+	if val, found = t.tr.Get(n.trieKey()); found {
+		return n, val, true
+	}
+	ce, _, _ := t.ClosestEncloser(n)
+	if ce.Equal(n) {
+		// n is an empty non-terminal: it exists but has no value.
+		return Name{}, nil, false
+	}
+	wc := Name{key: append(bytes.Clone(ce.key), wildcardLabel[0], 0)}
+	if val, found = t.tr.Get(wc.key); found {
+		return wc, val, true
+	}
+	return Name{}, nil, false
+}
+
+// Predecessor returns the name in the table that sorts immediately before n in
+// canonical order, whether or not n is in the table. For a name that does not
+// exist, this is the owner of the NSEC record covering it.
+func (t *Table) Predecessor(n Name) (p Name, val any, found bool) {
+	if n.IsRoot() || t.tr.Size() == 0 {
+		return Name{}, nil, false
+	}
+	// Keys end in the label terminator 0, the smallest byte, so the keys
+	// less than n are exactly those less than or equal to n without it.
+	k, v, _ := t.tr.GetLessOrEqual(n.key[:len(n.key)-1])
+	if k == nil {
+		return Name{}, nil, false
+	}
+	return Name{key: bytes.Clone(k)}, v, true
+}
+
+// Iterator returns an iterator over the table in canonical order.
+func (t *Table) Iterator() *Iterator {
+	return &Iterator{it: t.tr.Iterator()}
+}
+
+// Iterator walks a table in canonical order.
+type Iterator struct {
+	it *qp.Iterator
+}
+
+// Seek positions the iterator at the first name that sorts at or after n.
+func (it *Iterator) Seek(n Name) {
+	it.it.Seek(n.trieKey())
+}
+
+// Next returns the next name and its value.
+func (it *Iterator) Next() (n Name, val any, ok bool) {
+	k, v, ok := it.it.Next()
+	if !ok {
+		return Name{}, nil, false
+	}
+	return Name{key: bytes.Clone(k)}, v, true
+}
+
+// commonLabels returns the length of the longest common prefix of a and b
+// that ends on a label boundary. Escape pairs never contain 0, so every 0 is a
+// terminator.
+func commonLabels(a, b []byte) int {
+	l := 0
+	for i := 0; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+		if a[i] == 0 {
+			l = i + 1
+		}
+	}
+	return l
+}
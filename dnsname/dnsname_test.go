@@ -0,0 +1,285 @@
+package dnsname
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// canonical is the example from RFC 4034, section 6.1, in canonical order.
+var canonical = []string{
+	"example.",
+	"a.example.",
+	"yljkjljk.a.example.",
+	"Z.a.example.",
+	"zABC.a.EXAMPLE.",
+	"z.example.",
+	"\\001.z.example.",
+	"*.z.example.",
+	"\\200.z.example.",
+}
+
+func Test_ParseName(t *testing.T) {
+	cases := []struct {
+		in, out string
+	}{
+		{"", "."},
+		{".", "."},
+		{"com", "com."},
+		{"WWW.Example.COM.", "www.example.com."},
+		{"a\\.b.c.", "a\\.b.c."},
+		{"a\\\\b.c", "a\\\\b.c."},
+		{"\\000\\001\\002.x", "\\000\\001\\002.x."},
+		{"\\065b.x", "ab.x."},
+		{"sp\\ ace.x", "sp\\032ace.x."},
+	}
+	for _, c := range cases {
+		n, err := ParseName(c.in)
+		if err != nil {
+			t.Fatalf("ParseName(%q): %v", c.in, err)
+		}
+		if n.String() != c.out {
+			t.Errorf("ParseName(%q) = %q, want %q", c.in, n.String(), c.out)
+		}
+		if m := MustParseName(n.String()); !m.Equal(n) {
+			t.Errorf("%q does not round trip", c.in)
+		}
+	}
+
+	long := make([]byte, 64)
+	for i := range long {
+		long[i] = 'a'
+	}
+	bad := []string{"a..b", ".a", "a\\", "a\\25", "a\\256", string(long)}
+	var name string
+	for range 64 {
+		name += "abc."
+	}
+	bad = append(bad, name)
+	for _, s := range bad {
+		if _, err := ParseName(s); err == nil {
+			t.Errorf("ParseName(%q) succeeded", s)
+		}
+	}
+}
+
+func Test_NameParentChild(t *testing.T) {
+	n := MustParseName("www.example.com")
+	if got := n.Parent().String(); got != "example.com." {
+		t.Errorf("Parent = %q", got)
+	}
+	if !Root.Parent().IsRoot() || !MustParseName("com").Parent().IsRoot() {
+		t.Error("parent of a TLD or root is not the root")
+	}
+	c, err := n.Parent().Child([]byte("WWW"))
+	if err != nil || !c.Equal(n) {
+		t.Errorf("Child = %v, %v", c, err)
+	}
+}
+
+func Test_ZeroName(t *testing.T) {
+	var zero Name
+	if !zero.Equal(Root) || zero.Compare(Root) != 0 || zero.String() != "." {
+		t.Errorf("zero Name is not the root")
+	}
+	tb := New()
+	if tb.Exists(zero) {
+		t.Errorf("Exists(zero) in an empty table")
+	}
+	tb.Insert(zero, 1)
+	if v, found := tb.Get(Root); !found || v != 1 {
+		t.Errorf("Get(Root) = %v, %v", v, found)
+	}
+	if ce, _, found := tb.ClosestEncloser(zero); !found || !ce.IsRoot() {
+		t.Errorf("ClosestEncloser(zero) = %v, %v", ce, found)
+	}
+	if _, found := tb.Delete(zero); !found || tb.Size() != 0 {
+		t.Errorf("Delete(zero) found %v, size %d", found, tb.Size())
+	}
+}
+
+func Test_CanonicalOrder(t *testing.T) {
+	tb := New()
+	perm := rand.Perm(len(canonical))
+	for _, i := range perm {
+		tb.Insert(MustParseName(canonical[i]), i)
+	}
+	it := tb.Iterator()
+	for i, s := range canonical {
+		n, v, ok := it.Next()
+		if !ok || !n.Equal(MustParseName(s)) || v != i {
+			t.Fatalf("position %d: got %v %v %v, want %s", i, n, v, ok, s)
+		}
+		if i > 0 && MustParseName(canonical[i-1]).Compare(n) >= 0 {
+			t.Fatalf("Compare does not order %s before %s", canonical[i-1], s)
+		}
+	}
+	if _, _, ok := it.Next(); ok {
+		t.Fatal("iterator not exhausted")
+	}
+
+	it.Seek(MustParseName("b.example"))
+	if n, _, _ := it.Next(); n.String() != "z.example." {
+		t.Errorf("Seek(b.example) = %v", n)
+	}
+}
+
+func Test_Predecessor(t *testing.T) {
+	tb := New()
+	for i, s := range canonical {
+		tb.Insert(MustParseName(s), i)
+	}
+	for i, s := range canonical {
+		p, v, found := tb.Predecessor(MustParseName(s))
+		if i == 0 {
+			if found {
+				t.Errorf("Predecessor(%s) = %v", s, p)
+			}
+			continue
+		}
+		if !found || !p.Equal(MustParseName(canonical[i-1])) || v != i-1 {
+			t.Errorf("Predecessor(%s) = %v %v %v", s, p, v, found)
+		}
+	}
+
+	// Names that do not exist are covered by the NSEC of their predecessor.
+	cover := map[string]string{
+		"b.example.":            "zABC.a.example.",
+		"0.a.example.":          "a.example.",
+		"zz.example.":           "\\200.z.example.",
+		"x.yljkjljk.a.example.": "yljkjljk.a.example.",
+		"abc.":                  "",
+		".":                     "",
+	}
+	for q, want := range cover {
+		p, _, found := tb.Predecessor(MustParseName(q))
+		if want == "" {
+			if found {
+				t.Errorf("Predecessor(%s) = %v", q, p)
+			}
+			continue
+		}
+		if !found || !p.Equal(MustParseName(want)) {
+			t.Errorf("Predecessor(%s) = %v %v, want %s", q, p, found, want)
+		}
+	}
+}
+
+// Test_Wildcard follows the example zone of RFC 4592, section 2.2.1.
+func Test_Wildcard(t *testing.T) {
+	tb := New()
+	zone := []string{
+		"example.",
+		"*.example.",
+		"host1.example.",
+		"sub.*.example.",
+		"_ssh._tcp.host1.example.",
+		"_ssh._tcp.host2.example.",
+		"subdel.example.",
+	}
+	for _, s := range zone {
+		tb.Insert(MustParseName(s), s)
+	}
+
+	cases := []struct {
+		q, source string
+	}{
+		{"host3.example.", "*.example."},
+		{"foo.bar.example.", "*.example."},
+		{"host1.example.", "host1.example."},
+		{"sub.*.example.", "sub.*.example."},
+		{"_telnet._tcp.host1.example.", ""}, // _tcp.host1.example. is an empty non-terminal
+		{"host.subdel.example.", ""},        // subdel.example. is the closest encloser
+		{"ghost.*.example.", ""},            // *.example. is the closest encloser, not a source
+		{"_tcp.host1.example.", ""},
+		{"other.", ""},
+	}
+	for _, c := range cases {
+		src, v, found := tb.Lookup(MustParseName(c.q))
+		if c.source == "" {
+			if found {
+				t.Errorf("Lookup(%s) = %v %v", c.q, src, v)
+			}
+			continue
+		}
+		if !found || src.String() != c.source || v != c.source {
+			t.Errorf("Lookup(%s) = %v %v %v, want %s", c.q, src, v, found, c.source)
+		}
+	}
+}
+
+func Test_ClosestEncloser(t *testing.T) {
+	tb := New()
+	if ce, _, found := tb.ClosestEncloser(MustParseName("a.b.")); !ce.IsRoot() || found {
+		t.Errorf("empty table: %v %v", ce, found)
+	}
+	for _, s := range []string{"example.", "a.b.c.example.", "x.example.", "xa\\000.example."} {
+		tb.Insert(MustParseName(s), s)
+	}
+	cases := []struct {
+		q, ce string
+		found bool
+	}{
+		{"example.", "example.", true},
+		{"q.example.", "example.", true},
+		{"q.c.example.", "c.example.", false},
+		{"q.b.c.example.", "b.c.example.", false},
+		{"a.b.c.example.", "a.b.c.example.", true},
+		{"z.a.b.c.example.", "a.b.c.example.", true},
+		{"xa.example.", "example.", true},
+		{"y.x.example.", "x.example.", true},
+		{"org.", ".", false},
+	}
+	for _, c := range cases {
+		ce, v, found := tb.ClosestEncloser(MustParseName(c.q))
+		if ce.String() != c.ce || found != c.found || (found && v != c.ce) {
+			t.Errorf("ClosestEncloser(%s) = %v %v %v, want %s %v", c.q, ce, v, found, c.ce, c.found)
+		}
+		if !tb.Exists(ce) {
+			t.Errorf("closest encloser %v of %s does not exist", ce, c.q)
+		}
+	}
+}
+
+func Test_ClosestEncloserRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	labels := []string{"a", "b", "A", "\\000", "\\001", "ab", "*"}
+	randName := func() Name {
+		var s []string
+		for range r.Intn(5) {
+			s = append(s, labels[r.Intn(len(labels))])
+		}
+		return MustParseName(joinLabels(s))
+	}
+
+	tb := New()
+	var names []Name
+	for range 200 {
+		n := randName()
+		tb.Insert(n, nil)
+		names = append(names, n)
+	}
+	for range 1000 {
+		q := randName()
+		// The slow way: the first ancestor with a stored descendant.
+		want := q
+		for !want.IsRoot() && !slices.ContainsFunc(names, func(n Name) bool { return isBelow(n, want) }) {
+			want = want.Parent()
+		}
+		if ce, _, _ := tb.ClosestEncloser(q); !ce.Equal(want) {
+			t.Fatalf("ClosestEncloser(%v) = %v, want %v", q, ce, want)
+		}
+	}
+}
+
+func isBelow(n, anc Name) bool {
+	return len(n.key) >= len(anc.key) && string(n.key[:len(anc.key)]) == string(anc.key)
+}
+
+func joinLabels(s []string) string {
+	out := ""
+	for _, l := range s {
+		out += l + "."
+	}
+	return out
+}
@@ -0,0 +1,221 @@
+package dnsname
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	maxLabelLen = 63
+	maxNameLen  = 255 // wire format, including length octets and the root label
+)
+
+var (
+	errEmptyLabel   = errors.New("empty label")
+	errLabelTooLong = fmt.Errorf("label longer than %d octets", maxLabelLen)
+	errNameTooLong  = fmt.Errorf("name longer than %d octets", maxNameLen)
+	errBadEscape    = errors.New("bad escape")
+)
+
+// Name is a fully qualified domain name in trie key form: labels from the
+// root down, each case-folded, escaped and terminated by a zero byte, after a
+// leading zero byte for the root. Byte order of keys is DNSSEC canonical order
+// and an ancestor's key is a prefix of its descendants' keys.
+//
+// Within a label, 0x00 and 0x01 are written as 0x01 0x01 and 0x01 0x02, which
+// keeps the order and leaves 0x00 free for the terminator.
+type Name struct {
+	key []byte
+}
+
+// Root is the root name ".".
+var Root = Name{key: []byte{0}}
+
+// ParseName parses a name in presentation format, such as "www.Example.com."
+// or "www.example.com". Names are always taken as fully qualified. A backslash
+// escapes the next character, or gives an octet as three decimal digits.
+func ParseName(s string) (Name, error) {
+	labels, err := splitLabels(s)
+	if err != nil {
+		return Name{}, err
+	}
+	return FromLabels(labels)
+}
+
+// MustParseName is like ParseName but panics on error.
+func MustParseName(s string) Name {
+	n, err := ParseName(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// FromLabels builds a name from its labels, leftmost first, without the root label.
+func FromLabels(labels [][]byte) (Name, error) {
+	wire := 1
+	key := []byte{0}
+	for i := len(labels) - 1; i >= 0; i-- {
+		l := labels[i]
+		if len(l) == 0 {
+			return Name{}, errEmptyLabel
+		}
+		if len(l) > maxLabelLen {
+			return Name{}, errLabelTooLong
+		}
+		wire += 1 + len(l)
+		for _, b := range l {
+			switch {
+			case b == 0:
+				key = append(key, 1, 1)
+			case b == 1:
+				key = append(key, 1, 2)
+			case 'A' <= b && b <= 'Z':
+				key = append(key, b+'a'-'A')
+			default:
+				key = append(key, b)
+			}
+		}
+		key = append(key, 0)
+	}
+	if wire > maxNameLen {
+		return Name{}, errNameTooLong
+	}
+	return Name{key: key}, nil
+}
+
+func splitLabels(s string) ([][]byte, error) {
+	if s == "." || s == "" {
+		return nil, nil
+	}
+	var labels [][]byte
+	var cur []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '.':
+			if len(cur) == 0 {
+				return nil, errEmptyLabel
+			}
+			labels = append(labels, cur)
+			cur = nil
+		case '\\':
+			if i+1 >= len(s) {
+				return nil, errBadEscape
+			}
+			if isDigit(s[i+1]) {
+				if i+3 >= len(s) || !isDigit(s[i+2]) || !isDigit(s[i+3]) {
+					return nil, errBadEscape
+				}
+				v := int(s[i+1]-'0')*100 + int(s[i+2]-'0')*10 + int(s[i+3]-'0')
+				if v > 255 {
+					return nil, errBadEscape
+				}
+				cur = append(cur, byte(v))
+				i += 3
+			} else {
+				cur = append(cur, s[i+1])
+				i++
+			}
+		default:
+			cur = append(cur, c)
+		}
+	}
+	if len(cur) > 0 {
+		labels = append(labels, cur)
+	}
+	return labels, nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// Labels returns the case-folded labels, leftmost first.
+func (n Name) Labels() [][]byte {
+	if n.IsRoot() {
+		return nil
+	}
+	var labels [][]byte
+	var cur []byte
+	key := n.key[1:]
+	for i := 0; i < len(key); i++ {
+		switch key[i] {
+		case 0:
+			labels = append(labels, cur)
+			cur = nil
+		case 1:
+			i++
+			cur = append(cur, key[i]-1)
+		default:
+			cur = append(cur, key[i])
+		}
+	}
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return labels
+}
+
+// String returns the name in presentation format with a trailing dot.
+func (n Name) String() string {
+	labels := n.Labels()
+	if len(labels) == 0 {
+		return "."
+	}
+	var sb strings.Builder
+	for _, l := range labels {
+		for _, b := range l {
+			switch {
+			case b == '.' || b == '\\':
+				sb.WriteByte('\\')
+				sb.WriteByte(b)
+			case b < '!' || b > '~':
+				fmt.Fprintf(&sb, "\\%03d", b)
+			default:
+				sb.WriteByte(b)
+			}
+		}
+		sb.WriteByte('.')
+	}
+	return sb.String()
+}
+
+// Equal reports whether n and o are the same name, ignoring case.
+func (n Name) Equal(o Name) bool {
+	return bytes.Equal(n.trieKey(), o.trieKey())
+}
+
+// Compare returns -1, 0 or 1 as n sorts before, equal to or after o in DNSSEC canonical order.
+func (n Name) Compare(o Name) int {
+	return bytes.Compare(n.trieKey(), o.trieKey())
+}
+
+// IsRoot reports whether n is the root name. The zero Name counts as the root.
+func (n Name) IsRoot() bool {
+	return len(n.key) <= 1
+}
+
+// trieKey returns the key of n, that of Root for the zero Name.
+func (n Name) trieKey() []byte {
+	if len(n.key) == 0 {
+		return Root.key
+	}
+	return n.key
+}
+
+// Parent returns the name with the leftmost label removed. The root is its own parent.
+func (n Name) Parent() Name {
+	if n.IsRoot() {
+		return Root
+	}
+	i := bytes.LastIndexByte(n.key[:len(n.key)-1], 0)
+	return Name{key: n.key[:i+1]}
+}
+
+// Child returns the name with label prepended to n.
+func (n Name) Child(label []byte) (Name, error) {
+	return FromLabels(append([][]byte{label}, n.Labels()...))
+}
@@ -0,0 +1,103 @@
+package qp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// DumpTree writes an indented text view of the trie, or of the subtree holding
+// the keys that start with prefix if prefix is not empty. Each branch shows
+// its nibble index and bitmap, each twig is labelled with its nibble (- for a
+// key that ends before the index), and nodes shared with another trie through
+// copy-on-write are marked [shared].
+func (tr *Trie) DumpTree(w io.Writer, prefix []byte) error {
+	bw := bufio.NewWriter(w)
+	if n := tr.findPrefix(prefix); n != nil {
+		dumpTree(bw, n, "", 0, tr.shared.Load())
+	}
+	return bw.Flush()
+}
+
+func dumpTree(w *bufio.Writer, n *node, label string, depth int, shared bool) {
+	shared = shared || n.cowMarked()
+	w.WriteString(strings.Repeat("  ", depth))
+	w.WriteString(label)
+	if !n.isBranch() {
+		fmt.Fprintf(w, "leaf %s = %v", strconv.Quote(string(n.key())), n.val)
+	} else {
+		fmt.Fprintf(w, "branch index=%d bitmap=%#05x", n.index(), n.bitmap())
+	}
+	if shared {
+		w.WriteString(" [shared]")
+	}
+	w.WriteByte('\n')
+	if !n.isBranch() {
+		return
+	}
+
+	bitmap := n.bitmap()
+	twigs := n.twigs()
+	for i := range twigs {
+		b := bitmap & -bitmap
+		bitmap &^= b
+		dumpTree(w, &twigs[i], nibbleLabel(b)+": ", depth+1, shared)
+	}
+}
+
+// DumpDOT writes the trie, or the subtree holding the keys that start with
+// prefix, as a Graphviz digraph. Branches are boxes labelled with their nibble
+// index and bitmap, leaves are ellipses with their key and value, edges are
+// labelled with the twig's nibble, and nodes shared through copy-on-write are
+// filled grey.
+func (tr *Trie) DumpDOT(w io.Writer, prefix []byte) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("digraph qp {\n")
+	if n := tr.findPrefix(prefix); n != nil {
+		id := 0
+		dumpDOT(bw, n, &id, tr.shared.Load())
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+func dumpDOT(w *bufio.Writer, n *node, id *int, shared bool) int {
+	me := *id
+	*id++
+	shared = shared || n.cowMarked()
+	style := ""
+	if shared {
+		style = `, style=filled, fillcolor=lightgrey`
+	}
+	if !n.isBranch() {
+		label := strconv.Quote(string(n.key())) + " = " + fmt.Sprint(n.val)
+		fmt.Fprintf(w, "  n%d [shape=ellipse, label=\"%s\"%s];\n", me, dotEscape(label), style)
+		return me
+	}
+
+	fmt.Fprintf(w, "  n%d [shape=box, label=\"index %d\\nbitmap %#05x\"%s];\n", me, n.index(), n.bitmap(), style)
+	bitmap := n.bitmap()
+	twigs := n.twigs()
+	for i := range twigs {
+		b := bitmap & -bitmap
+		bitmap &^= b
+		child := dumpDOT(w, &twigs[i], id, shared)
+		fmt.Fprintf(w, "  n%d -> n%d [label=\"%s\"];\n", me, child, nibbleLabel(b))
+	}
+	return me
+}
+
+// nibbleLabel names the nibble a twig bit stands for.
+func nibbleLabel(b bitmapT) string {
+	if b == 1 {
+		return "-"
+	}
+	return strconv.FormatInt(int64(bits.TrailingZeros32(b)-1), 16)
+}
+
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
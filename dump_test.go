@@ -0,0 +1,113 @@
+package qp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_DumpTree(t *testing.T) {
+	tr := New()
+	for _, k := range []string{"a", "ab", "b", "c"} {
+		tr.Upsert([]byte(k), value1)
+	}
+
+	tests := []struct {
+		name   string
+		prefix string
+		expect string
+	}{
+		{
+			name:   "whole trie",
+			prefix: "",
+			expect: `branch index=1 bitmap=0x0001c
+  1: branch index=2 bitmap=0x00081
+    -: leaf "a" = 1
+    6: leaf "ab" = 1
+  2: leaf "b" = 1
+  3: leaf "c" = 1
+`,
+		},
+		{
+			name:   "prefix",
+			prefix: "a",
+			expect: `branch index=2 bitmap=0x00081
+  -: leaf "a" = 1
+  6: leaf "ab" = 1
+`,
+		},
+		{
+			name:   "prefix leaf",
+			prefix: "ab",
+			expect: "leaf \"ab\" = 1\n",
+		},
+		{
+			name:   "missing prefix",
+			prefix: "d",
+			expect: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tr.DumpTree(&buf, []byte(tt.prefix)); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.expect {
+				t.Fatalf("DumpTree got\n%s\nwant\n%s", buf.String(), tt.expect)
+			}
+		})
+	}
+}
+
+func Test_DumpShared(t *testing.T) {
+	tr := New()
+	for _, k := range []string{"a", "ab", "b", "c"} {
+		tr.Upsert([]byte(k), value1)
+	}
+	tx := tr.Txn()
+	tx.Upsert([]byte("c"), value2)
+	tr = tx.Commit()
+
+	var buf bytes.Buffer
+	if err := tr.DumpTree(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	expect := `branch index=1 bitmap=0x0001c
+  1: branch index=2 bitmap=0x00081 [shared]
+    -: leaf "a" = 1 [shared]
+    6: leaf "ab" = 1 [shared]
+  2: leaf "b" = 1
+  3: leaf "c" = 2
+`
+	if buf.String() != expect {
+		t.Fatalf("DumpTree got\n%s\nwant\n%s", buf.String(), expect)
+	}
+
+	buf.Reset()
+	if err := tr.DumpDOT(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	expect = `digraph qp {
+  n0 [shape=box, label="index 1\nbitmap 0x0001c"];
+  n1 [shape=box, label="index 2\nbitmap 0x00081", style=filled, fillcolor=lightgrey];
+  n2 [shape=ellipse, label="\"a\" = 1", style=filled, fillcolor=lightgrey];
+  n1 -> n2 [label="-"];
+  n3 [shape=ellipse, label="\"ab\" = 1", style=filled, fillcolor=lightgrey];
+  n1 -> n3 [label="6"];
+  n0 -> n1 [label="1"];
+  n4 [shape=ellipse, label="\"b\" = 1"];
+  n0 -> n4 [label="2"];
+  n5 [shape=ellipse, label="\"c\" = 2"];
+  n0 -> n5 [label="3"];
+}
+`
+	if buf.String() != expect {
+		t.Fatalf("DumpDOT got\n%s\nwant\n%s", buf.String(), expect)
+	}
+
+	buf.Reset()
+	_ = New().DumpDOT(&buf, nil)
+	if buf.String() != "digraph qp {\n}\n" {
+		t.Fatalf("empty DumpDOT got %q", buf.String())
+	}
+}
@@ -0,0 +1,264 @@
+package qp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf8"
+)
+
+// jsonPair is an element of the array form produced by MarshalJSON.
+// Exactly one of Key and Key64 is set; Key64 holds keys that are not valid UTF-8.
+type jsonPair struct {
+	Key   *string         `json:"key,omitempty"`
+	Key64 []byte          `json:"key64,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+// MarshalJSON encodes the trie in key order. If every key is valid UTF-8 the
+// result is an object, {"a":1,"b":2}. Otherwise it is an array of pairs,
+// [{"key":"a","value":1},{"key64":"/w==","value":2}], where keys that are not
+// valid UTF-8 are base64 encoded. Values are encoded with encoding/json.
+func (tr *Trie) MarshalJSON() ([]byte, error) {
+	asObject := true
+	it := tr.Iterator()
+	for {
+		k, _, ok := it.Next()
+		if !ok {
+			break
+		}
+		if !utf8.Valid(k) {
+			asObject = false
+			break
+		}
+	}
+
+	var buf bytes.Buffer
+	if asObject {
+		buf.WriteByte('{')
+	} else {
+		buf.WriteByte('[')
+	}
+	it = tr.Iterator()
+	for i := 0; ; i++ {
+		k, v, ok := it.Next()
+		if !ok {
+			break
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		val, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k, err)
+		}
+		if asObject {
+			key, _ := json.Marshal(string(k))
+			buf.Write(key)
+			buf.WriteByte(':')
+			buf.Write(val)
+			continue
+		}
+
+		p := jsonPair{Value: val}
+		if utf8.Valid(k) {
+			s := string(k)
+			p.Key = &s
+		} else {
+			p.Key64 = k
+		}
+		pair, err := json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(pair)
+	}
+	if asObject {
+		buf.WriteByte('}')
+	} else {
+		buf.WriteByte(']')
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON upserts the pairs of either form produced by MarshalJSON into
+// the trie. Like decoding into a map, existing keys that are not mentioned are
+// kept. Values are decoded into any, so numbers become float64.
+func (tr *Trie) UnmarshalJSON(data []byte) error {
+	tr.initHandlers()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		for dec.More() {
+			tok, err = dec.Token()
+			if err != nil {
+				return err
+			}
+			key := tok.(string)
+			if err = CheckKey([]byte(key)); err != nil {
+				return err
+			}
+			var v any
+			if err = dec.Decode(&v); err != nil {
+				return err
+			}
+			tr.Upsert([]byte(key), v)
+		}
+	case json.Delim('['):
+		for dec.More() {
+			var p jsonPair
+			if err = dec.Decode(&p); err != nil {
+				return err
+			}
+			var key []byte
+			switch {
+			case p.Key != nil && p.Key64 == nil:
+				key = []byte(*p.Key)
+			case p.Key == nil && p.Key64 != nil:
+				key = p.Key64
+			default:
+				return fmt.Errorf("pair must have exactly one of key and key64")
+			}
+			if err = CheckKey(key); err != nil {
+				return err
+			}
+			var v any
+			if err = json.Unmarshal(p.Value, &v); err != nil {
+				return err
+			}
+			tr.Upsert(key, v)
+		}
+	default:
+		return fmt.Errorf("expected object or array, got %v", tok)
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// WriteTSV writes one line per pair in key order: the escaped key, a tab and
+// the JSON encoded value. In keys, backslash, tab, newline and carriage return
+// are written as \\, \t, \n and \r, and other control bytes or bytes that are
+// not part of valid UTF-8 as \xNN.
+func (tr *Trie) WriteTSV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var line []byte
+	it := tr.Iterator()
+	for {
+		k, v, ok := it.Next()
+		if !ok {
+			break
+		}
+		val, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", k, err)
+		}
+		line = appendEscapedKey(line[:0], k)
+		line = append(line, '\t')
+		line = append(line, val...)
+		line = append(line, '\n')
+		if _, err = bw.Write(line); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadTSV upserts every line written by WriteTSV into the trie.
+// Empty lines are skipped.
+func (tr *Trie) ReadTSV(r io.Reader) error {
+	tr.initHandlers()
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<30)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		tab := bytes.IndexByte(line, '\t')
+		if tab < 0 {
+			return fmt.Errorf("line %d: missing tab", n)
+		}
+		key, err := unescapeKey(line[:tab])
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+		if err = CheckKey(key); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+		var v any
+		if err = json.Unmarshal(line[tab+1:], &v); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+		tr.Upsert(key, v)
+	}
+	return sc.Err()
+}
+
+func appendEscapedKey(dst, key []byte) []byte {
+	for len(key) > 0 {
+		r, size := utf8.DecodeRune(key)
+		switch {
+		case r == '\\':
+			dst = append(dst, '\\', '\\')
+		case r == '\t':
+			dst = append(dst, '\\', 't')
+		case r == '\n':
+			dst = append(dst, '\\', 'n')
+		case r == '\r':
+			dst = append(dst, '\\', 'r')
+		case r == utf8.RuneError && size == 1, r < 0x20, r == 0x7f:
+			dst = append(dst, '\\', 'x')
+			dst = strconv.AppendUint(dst, uint64(key[0])>>4, 16)
+			dst = strconv.AppendUint(dst, uint64(key[0])&0xf, 16)
+		default:
+			dst = append(dst, key[:size]...)
+		}
+		key = key[size:]
+	}
+	return dst
+}
+
+func unescapeKey(s []byte) ([]byte, error) {
+	key := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			key = append(key, s[i])
+			continue
+		}
+		i++
+		if i >= len(s) {
+			return nil, fmt.Errorf("trailing backslash in key")
+		}
+		switch s[i] {
+		case '\\':
+			key = append(key, '\\')
+		case 't':
+			key = append(key, '\t')
+		case 'n':
+			key = append(key, '\n')
+		case 'r':
+			key = append(key, '\r')
+		case 'x':
+			if i+2 >= len(s) {
+				return nil, fmt.Errorf("short \\x escape in key")
+			}
+			b, err := strconv.ParseUint(string(s[i+1:i+3]), 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("bad \\x escape in key: %w", err)
+			}
+			key = append(key, byte(b))
+			i += 2
+		default:
+			return nil, fmt.Errorf("unknown escape \\%c in key", s[i])
+		}
+	}
+	return key, nil
+}
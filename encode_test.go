@@ -0,0 +1,126 @@
+package qp
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []KVPair
+		expect string
+	}{
+		{
+			name:   "empty trie",
+			data:   []KVPair{},
+			expect: `{}`,
+		},
+		{
+			name: "utf8 keys",
+			data: []KVPair{
+				{[]byte("b"), "x"},
+				{[]byte("a"), 1},
+				{[]byte("ab"), []int{1, 2}},
+				{[]byte("\"q\""), nil},
+			},
+			expect: `{"\"q\"":null,"a":1,"ab":[1,2],"b":"x"}`,
+		},
+		{
+			name: "binary keys",
+			data: []KVPair{
+				{[]byte("b"), 2},
+				{[]byte("a\xff"), 1},
+			},
+			expect: `[{"key64":"Yf8=","value":1},{"key":"b","value":2}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := New()
+			for _, kv := range tt.data {
+				tr.Upsert(kv.Key, kv.Value)
+			}
+			data, err := json.Marshal(tr)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(data) != tt.expect {
+				t.Fatalf("Marshal got %s want %s", data, tt.expect)
+			}
+
+			var decoded Trie
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if decoded.Size() != tr.Size() {
+				t.Fatalf("Size got %d want %d", decoded.Size(), tr.Size())
+			}
+			again, _ := json.Marshal(&decoded)
+			if !bytes.Equal(again, data) {
+				t.Fatalf("round trip got %s want %s", again, data)
+			}
+		})
+	}
+}
+
+func Test_UnmarshalJSONErrors(t *testing.T) {
+	inputs := []string{
+		`1`,
+		`{"": 1}`,
+		`[{"value": 1}]`,
+		`[{"key": "a", "key64": "YQ==", "value": 1}]`,
+		`{"a": }`,
+	}
+	for _, in := range inputs {
+		tr := New()
+		if err := json.Unmarshal([]byte(in), tr); err == nil {
+			t.Errorf("Unmarshal(%s) should fail", in)
+		}
+	}
+}
+
+func Test_TSV(t *testing.T) {
+	data := []KVPair{
+		{[]byte("plain"), "v"},
+		{[]byte("tab\tnew\nline\r\\"), 1.5},
+		{[]byte("bin\x00\x7f\xff"), []any{"x"}},
+		{[]byte("ключ"), map[string]any{"a": true}},
+	}
+	tr := New()
+	for _, kv := range data {
+		tr.Upsert(kv.Key, kv.Value)
+	}
+
+	var buf bytes.Buffer
+	if err := tr.WriteTSV(&buf); err != nil {
+		t.Fatalf("WriteTSV: %v", err)
+	}
+	expect := "bin\\x00\\x7f\\xff\t[\"x\"]\n" +
+		"plain\t\"v\"\n" +
+		"tab\\tnew\\nline\\r\\\\\t1.5\n" +
+		"ключ\t{\"a\":true}\n"
+	if buf.String() != expect {
+		t.Fatalf("WriteTSV got %q want %q", buf.String(), expect)
+	}
+
+	loaded := New()
+	if err := loaded.ReadTSV(&buf); err != nil {
+		t.Fatalf("ReadTSV: %v", err)
+	}
+	if got, want := loaded.Walk(math.MaxInt, nil), tr.Walk(math.MaxInt, nil); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ReadTSV got %v want %v", got, want)
+	}
+
+	bad := []string{"novalue\n", "k\\q\t1\n", "k\\x4\t1\n", "k\t{\n", "\t1\n"}
+	for _, in := range bad {
+		if err := New().ReadTSV(strings.NewReader(in)); err == nil {
+			t.Errorf("ReadTSV(%q) should fail", in)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package qp
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// FuzzyMatch is a key found by Fuzzy, with its edit distance from the query.
+type FuzzyMatch struct {
+	Key   []byte
+	Value any
+	Dist  int
+}
+
+// Fuzzy returns the pairs whose keys are within Levenshtein distance maxDist
+// of query, in key order. Distances count byte insertions, deletions and
+// substitutions. The query is searched for as an automaton whose states are
+// rows of the edit distance table, built as the trie is descended, so a prefix
+// shared by many keys is stepped over once, and a subtree is left as soon as no
+// entry of its row is within maxDist.
+func (tr *Trie) Fuzzy(query []byte, maxDist int) []FuzzyMatch {
+	return tr.fuzzy(query, maxDist, false)
+}
+
+// FuzzyDamerau is Fuzzy also counting the transposition of two adjacent
+// bytes as one edit (optimal string alignment distance).
+func (tr *Trie) FuzzyDamerau(query []byte, maxDist int) []FuzzyMatch {
+	return tr.fuzzy(query, maxDist, true)
+}
+
+func (tr *Trie) fuzzy(query []byte, maxDist int, damerau bool) []FuzzyMatch {
+	if tr.root.isNil() || maxDist < 0 {
+		return nil
+	}
+	l := newLevenshtein(query, maxDist, damerau)
+	var matches []FuzzyMatch
+	tr.searchAutomaton(l, math.MaxInt, func(leaf *node, state int) {
+		matches = append(matches, FuzzyMatch{Key: leaf.key(), Value: leaf.val, Dist: l.dist(state)})
+	})
+	return matches
+}
+
+// levenshtein is an Automaton accepting the keys within maxDist of query,
+// built lazily. A state is a row of the edit distance table, entries above
+// maxDist cut to maxDist+1. For Damerau, the row is followed by the entries a
+// transposition ending with the next byte could give, when it is the byte
+// before. State 0 is dead.
+type levenshtein struct {
+	query   []byte
+	maxDist int
+	damerau bool
+	dfa     dfaCache
+	rows    [][]int
+}
+
+func newLevenshtein(query []byte, maxDist int, damerau bool) *levenshtein {
+	// No distance is larger than the longest key or the query.
+	maxDist = min(maxDist, max(len(query), maxKeyBytes))
+	l := &levenshtein{query: query, maxDist: maxDist, damerau: damerau}
+	sets := make([]byteSet, len(query))
+	for i, b := range query {
+		sets[i].add(b)
+	}
+	l.dfa.init(sets)
+	n := len(query) + 1
+	if damerau {
+		n *= 2
+	}
+	dead, start := make([]int, n), make([]int, n)
+	for j := range n {
+		dead[j], start[j] = maxDist+1, maxDist+1
+	}
+	for j := range min(len(query)+1, maxDist+1) {
+		start[j] = j
+	}
+	l.intern(dead)
+	l.intern(start)
+	return l
+}
+
+// intern returns the state for row.
+func (l *levenshtein) intern(row []int) int {
+	key := make([]byte, 0, len(row))
+	for _, d := range row {
+		key = binary.AppendUvarint(key, uint64(d))
+	}
+	id, added := l.dfa.intern(string(key))
+	if added {
+		l.rows = append(l.rows, row)
+	}
+	return id
+}
+
+func (l *levenshtein) Start() int {
+	return 1
+}
+
+func (l *levenshtein) Step(state int, c byte) int {
+	if next, ok := l.dfa.cached(state, c); ok {
+		return next
+	}
+	m := len(l.query)
+	cut := l.maxDist + 1
+	prev := l.rows[state]
+	next := make([]int, len(prev))
+	row := next[:m+1]
+	row[0] = min(prev[0]+1, cut)
+	best := row[0]
+	for j := 1; j <= m; j++ {
+		cost := 1
+		if l.query[j-1] == c {
+			cost = 0
+		}
+		d := min(prev[j]+1, row[j-1]+1, prev[j-1]+cost, cut)
+		if l.damerau && j > 1 && l.query[j-2] == c {
+			d = min(d, prev[m+1+j])
+		}
+		row[j] = d
+		best = min(best, d)
+	}
+	if l.damerau {
+		swap := next[m+1:]
+		for j := range swap {
+			swap[j] = cut
+			if j > 1 && l.query[j-1] == c {
+				swap[j] = min(prev[j-2]+1, cut)
+			}
+		}
+	}
+	id := 0
+	if best <= l.maxDist {
+		id = l.intern(next)
+	}
+	l.dfa.set(state, c, id)
+	return id
+}
+
+func (l *levenshtein) IsMatch(state int) bool {
+	return l.dist(state) <= l.maxDist
+}
+
+func (l *levenshtein) CanMatch(state int) bool {
+	return state != 0
+}
+
+// dist returns the distance of a key ending in state from the query.
+func (l *levenshtein) dist(state int) int {
+	return l.rows[state][len(l.query)]
+}
@@ -0,0 +1,112 @@
+package qp
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// editDistance is the textbook table, with transpositions if damerau.
+func editDistance(a, b []byte, damerau bool) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if damerau && i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func Test_Fuzzy(t *testing.T) {
+	tr := New()
+	for _, k := range []string{"kitten", "sitting", "mitten", "kitchen", "bitten", "kitte", "iktten"} {
+		tr.Upsert([]byte(k), k)
+	}
+	got := tr.Fuzzy([]byte("kitten"), 1)
+	want := []FuzzyMatch{{[]byte("bitten"), "bitten", 1}, {[]byte("kitte"), "kitte", 1}, {[]byte("kitten"), "kitten", 0}, {[]byte("mitten"), "mitten", 1}}
+	checkFuzzy(t, got, want)
+
+	got = tr.FuzzyDamerau([]byte("kitten"), 1)
+	want = []FuzzyMatch{{[]byte("bitten"), "bitten", 1}, {[]byte("iktten"), "iktten", 1}, {[]byte("kitte"), "kitte", 1}, {[]byte("kitten"), "kitten", 0}, {[]byte("mitten"), "mitten", 1}}
+	checkFuzzy(t, got, want)
+
+	if got := tr.Fuzzy([]byte("kitten"), -1); got != nil {
+		t.Fatalf("negative distance got %v", got)
+	}
+	if got := New().Fuzzy([]byte("x"), 3); got != nil {
+		t.Fatalf("empty trie got %v", got)
+	}
+}
+
+func Test_FuzzyWords(t *testing.T) {
+	words := loadTestData(wordsPath)[:20000]
+	tr := New()
+	for _, w := range words {
+		tr.Upsert(w, nil)
+	}
+	r := rand.New(rand.NewSource(1))
+	for range 30 {
+		q := []byte(string(words[r.Intn(len(words))]))
+		if len(q) > 1 && r.Intn(2) == 0 {
+			i := r.Intn(len(q) - 1)
+			q[i], q[i+1] = q[i+1], q[i]
+		}
+		for _, damerau := range []bool{false, true} {
+			maxDist := r.Intn(3)
+			want := map[string]int{}
+			for _, w := range words {
+				if d := editDistance(w, q, damerau); d <= maxDist {
+					want[string(w)] = d
+				}
+			}
+			got := tr.fuzzy(q, maxDist, damerau)
+			if len(got) != len(want) {
+				t.Fatalf("%q within %d (damerau %v): got %d keys want %d", q, maxDist, damerau, len(got), len(want))
+			}
+			for i, m := range got {
+				if d, ok := want[string(m.Key)]; !ok || d != m.Dist {
+					t.Fatalf("%q: got %q at %d want %d, %v", q, m.Key, m.Dist, d, ok)
+				}
+				if i > 0 && string(got[i-1].Key) >= string(m.Key) {
+					t.Fatal("matches out of key order")
+				}
+			}
+		}
+	}
+}
+
+func checkFuzzy(t *testing.T, got, want []FuzzyMatch) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d matches want %d: %v", len(got), len(want), got)
+	}
+	for i := range got {
+		if string(got[i].Key) != string(want[i].Key) || got[i].Value != want[i].Value || got[i].Dist != want[i].Dist {
+			t.Fatalf("match %d got %q %v %d want %q %v %d", i, got[i].Key, got[i].Value, got[i].Dist, want[i].Key, want[i].Value, want[i].Dist)
+		}
+	}
+}
+
+func Benchmark_Words_Fuzzy(b *testing.B) {
+	tr := New()
+	for _, w := range loadTestData(wordsPath) {
+		tr.Upsert(w, nil)
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		tr.Fuzzy([]byte("algorithm"), 2)
+	}
+}
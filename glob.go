@@ -0,0 +1,223 @@
+package qp
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+var errBadPattern = errors.New("qp: syntax error in pattern")
+
+// Match returns up to limit pairs, in key order, whose keys match the glob
+// pattern. In the pattern, ? matches any byte, * any run of bytes, [abc] and
+// [a-z] a byte in the class, [!abc] or [^abc] a byte not in it, and \c the
+// byte c. The pattern is searched for as an automaton whose states are the
+// sets of pattern positions a key can be at, so subtrees whose next nibble no
+// position accepts are never visited.
+func (tr *Trie) Match(pattern string, limit int) ([]KVPair, error) {
+	var g glob
+	if err := g.compile(pattern); err != nil {
+		return nil, err
+	}
+	return tr.SearchAutomaton(&g, limit), nil
+}
+
+// globTok is a pattern element: a star, or the set of bytes a single
+// position matches with hi the set of their high nibbles.
+type globTok struct {
+	star bool
+	set  byteSet
+	hi   uint16
+}
+
+func (t *globTok) add(b byte) {
+	t.set.add(b)
+	t.hi |= 1 << (b >> 4)
+}
+
+// glob is an Automaton for a compiled pattern, built lazily. A state stands
+// for a bit set of pattern positions; position len(toks) means the whole
+// pattern matched. State 0 is the empty set.
+type glob struct {
+	toks   []globTok
+	words  int // uint64s per set
+	dfa    dfaCache
+	states []globState
+	start  int
+}
+
+type globState struct {
+	pos    []uint64
+	hi     uint16 // high nibbles of the bytes some position matches
+	accept bool
+}
+
+func (g *glob) compile(p string) error {
+	for i := 0; i < len(p); i++ {
+		var t globTok
+		switch c := p[i]; c {
+		case '*':
+			if n := len(g.toks); n > 0 && g.toks[n-1].star {
+				continue
+			}
+			t.star = true
+		case '?':
+			for b := range 256 {
+				t.add(byte(b))
+			}
+		case '[':
+			end, err := t.class(p, i+1)
+			if err != nil {
+				return err
+			}
+			i = end
+		case '\\':
+			if i++; i >= len(p) {
+				return errBadPattern
+			}
+			t.add(p[i])
+		default:
+			t.add(c)
+		}
+		g.toks = append(g.toks, t)
+	}
+	g.words = (len(g.toks) + 1 + 63) / 64
+	sets := make([]byteSet, len(g.toks))
+	for p := range g.toks {
+		sets[p] = g.toks[p].set
+	}
+	g.dfa.init(sets)
+	g.intern(make([]uint64, g.words))
+	start := make([]uint64, g.words)
+	start[0] = 1
+	g.closure(start)
+	g.start = g.intern(start)
+	return nil
+}
+
+// class parses the class starting at p[i], after the '[', and returns the
+// index of its closing ']'.
+func (t *globTok) class(p string, i int) (int, error) {
+	negate := i < len(p) && (p[i] == '!' || p[i] == '^')
+	if negate {
+		i++
+	}
+	var in [256]bool
+	for first := true; ; first = false {
+		if i >= len(p) {
+			return 0, errBadPattern
+		}
+		lo := p[i]
+		if lo == ']' && !first {
+			break
+		}
+		if lo == '\\' {
+			if i++; i >= len(p) {
+				return 0, errBadPattern
+			}
+			lo = p[i]
+		}
+		hi := lo
+		if i+2 < len(p) && p[i+1] == '-' && p[i+2] != ']' {
+			i += 2
+			if hi = p[i]; hi == '\\' {
+				if i++; i >= len(p) {
+					return 0, errBadPattern
+				}
+				hi = p[i]
+			}
+			if hi < lo {
+				return 0, errBadPattern
+			}
+		}
+		for b := int(lo); b <= int(hi); b++ {
+			in[b] = true
+		}
+		i++
+	}
+	for b := range 256 {
+		if in[b] != negate {
+			t.add(byte(b))
+		}
+	}
+	return i, nil
+}
+
+// intern returns the state for the set pos.
+func (g *glob) intern(pos []uint64) int {
+	key := make([]byte, 0, 8*len(pos))
+	for _, w := range pos {
+		key = binary.LittleEndian.AppendUint64(key, w)
+	}
+	id, added := g.dfa.intern(string(key))
+	if added {
+		st := globState{pos: pos, accept: pos[len(g.toks)/64]&(1<<(len(g.toks)%64)) != 0}
+		g.each(pos, func(p int) {
+			if t := &g.toks[p]; t.star {
+				st.hi = 0xffff
+			} else {
+				st.hi |= t.hi
+			}
+		})
+		g.states = append(g.states, st)
+	}
+	return id
+}
+
+// closure adds the position after every star, as a star can match nothing.
+func (g *glob) closure(st []uint64) {
+	for p, t := range g.toks {
+		if t.star && st[p/64]&(1<<(p%64)) != 0 {
+			st[(p+1)/64] |= 1 << ((p + 1) % 64)
+		}
+	}
+}
+
+// each calls f for the positions in st that are before the end of the pattern.
+func (g *glob) each(st []uint64, f func(p int)) {
+	for w, word := range st {
+		for word != 0 {
+			p := w*64 + bits.TrailingZeros64(word)
+			word &= word - 1
+			if p < len(g.toks) {
+				f(p)
+			}
+		}
+	}
+}
+
+func (g *glob) Start() int {
+	return g.start
+}
+
+func (g *glob) Step(state int, b byte) int {
+	if next, ok := g.dfa.cached(state, b); ok {
+		return next
+	}
+	dst := make([]uint64, g.words)
+	g.each(g.states[state].pos, func(p int) {
+		t := &g.toks[p]
+		switch {
+		case t.star:
+			dst[p/64] |= 1 << (p % 64)
+		case t.set.has(b):
+			dst[(p+1)/64] |= 1 << ((p + 1) % 64)
+		}
+	})
+	g.closure(dst)
+	next := g.intern(dst)
+	g.dfa.set(state, b, next)
+	return next
+}
+
+func (g *glob) IsMatch(state int) bool {
+	return g.states[state].accept
+}
+
+func (g *glob) CanMatch(state int) bool {
+	return state != 0
+}
+
+func (g *glob) highNibbles(state int) uint16 {
+	return g.states[state].hi
+}
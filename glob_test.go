@@ -0,0 +1,150 @@
+package qp
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// globMatch is a backtracking matcher for the patterns used below.
+func globMatch(p, k string) bool {
+	if p == "" {
+		return k == ""
+	}
+	switch p[0] {
+	case '*':
+		for i := 0; i <= len(k); i++ {
+			if globMatch(p[1:], k[i:]) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		return k != "" && globMatch(p[1:], k[1:])
+	case '[':
+		// only [xy] and [!xy] with two bytes are generated
+		if k == "" {
+			return false
+		}
+		neg := p[1] == '!'
+		set := p[1:3]
+		if neg {
+			set = p[2:4]
+		}
+		in := k[0] == set[0] || k[0] == set[1]
+		rest := p[4:]
+		if neg {
+			rest = p[5:]
+		}
+		return in != neg && globMatch(rest, k[1:])
+	}
+	return k != "" && p[0] == k[0] && globMatch(p[1:], k[1:])
+}
+
+func Test_Match(t *testing.T) {
+	tr := New()
+	for _, k := range []string{"user:1:session", "user:1:profile", "user:22:session", "user:x", "users", "admin:1:session"} {
+		tr.Upsert([]byte(k), k)
+	}
+	tests := []struct {
+		pattern string
+		limit   int
+		keys    []string
+	}{
+		{"user:*:session", 10, []string{"user:1:session", "user:22:session"}},
+		{"user:*:session", 1, []string{"user:1:session"}},
+		{"*:1:*", 10, []string{"admin:1:session", "user:1:profile", "user:1:session"}},
+		{"user?", 10, []string{"users"}},
+		{"user:[0-9]:*", 10, []string{"user:1:profile", "user:1:session"}},
+		{"user:[!0-9]*", 10, []string{"user:x"}},
+		{"user:[^0-9]*", 10, []string{"user:x"}},
+		{"*", 0, nil},
+		{"\\u*s", 10, []string{"users"}},
+		{"nomatch*", 10, nil},
+	}
+	for _, tt := range tests {
+		pairs, err := tr.Match(tt.pattern, tt.limit)
+		if err != nil {
+			t.Fatalf("Match(%q): %v", tt.pattern, err)
+		}
+		var keys []string
+		for _, p := range pairs {
+			keys = append(keys, string(p.Key))
+		}
+		if !slices.Equal(keys, tt.keys) {
+			t.Errorf("Match(%q, %d) got %q want %q", tt.pattern, tt.limit, keys, tt.keys)
+		}
+	}
+
+	for _, p := range []string{"[", "[a", "a\\", "[z-a]", "[\\"} {
+		if _, err := tr.Match(p, 1); err == nil {
+			t.Errorf("Match(%q) accepted a bad pattern", p)
+		}
+	}
+}
+
+func Test_MatchRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	const alphabet = "\x00ab\xf1\xff"
+	tr := New()
+	var keys []string
+	for range 300 {
+		k := make([]byte, 1+r.Intn(6))
+		for i := range k {
+			k[i] = alphabet[r.Intn(len(alphabet))]
+		}
+		if _, isUpdate := tr.Upsert(k, nil); !isUpdate {
+			keys = append(keys, string(k))
+		}
+	}
+	slices.Sort(keys)
+
+	for range 500 {
+		var p []byte
+		for range 1 + r.Intn(5) {
+			c := alphabet[r.Intn(len(alphabet))]
+			switch r.Intn(6) {
+			case 0:
+				p = append(p, '*')
+			case 1:
+				p = append(p, '?')
+			case 2:
+				p = append(p, '[', c, alphabet[r.Intn(len(alphabet))], ']')
+			case 3:
+				p = append(p, '[', '!', c, alphabet[r.Intn(len(alphabet))], ']')
+			default:
+				p = append(p, c)
+			}
+		}
+		var want []string
+		for _, k := range keys {
+			if globMatch(string(p), k) {
+				want = append(want, k)
+			}
+		}
+		pairs, err := tr.Match(string(p), len(keys))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, kv := range pairs {
+			got = append(got, string(kv.Key))
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("Match(%q) got %q want %q", p, got, want)
+		}
+	}
+}
+
+func Benchmark_Words_Match(b *testing.B) {
+	tr := New()
+	for _, w := range loadTestData(wordsPath) {
+		tr.Upsert(w, nil)
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := tr.Match("qu?c*ly", 100); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
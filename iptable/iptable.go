@@ -0,0 +1,123 @@
+// Package iptable maps IP prefixes to values with longest-prefix-match lookup,
+// on top of a qp trie.
+//
+// qp branches on nibbles, but prefix lengths are bit granular, so a prefix is
+// stored as its address family followed by one byte per prefix bit. A prefix
+// is then a byte prefix of every prefix and address it contains, the longest
+// match for an address is the trie's longest key prefix, and byte order sorts
+// IPv4 before IPv6, then by address, then shorter prefixes first.
+package iptable
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/gnosnah/qp"
+)
+
+const (
+	family4 = 4
+	family6 = 6
+)
+
+// Table is a routing table from netip.Prefix to values.
+// A Table is not safe for concurrent writers.
+type Table struct {
+	tr *qp.Trie
+}
+
+// New creates an empty table.
+func New() *Table {
+	return &Table{tr: qp.New()}
+}
+
+// Size returns the number of prefixes in the table.
+func (t *Table) Size() int {
+	return t.tr.Size()
+}
+
+// Insert stores val for the masked form of p, replacing and returning any
+// previous value. It panics if p is not valid.
+func (t *Table) Insert(p netip.Prefix, val any) (oldVal any, isUpdate bool) {
+	return t.tr.Upsert(prefixKey(p), val)
+}
+
+// Delete removes p, returning its value.
+func (t *Table) Delete(p netip.Prefix) (oldVal any, found bool) {
+	return t.tr.Delete(prefixKey(p))
+}
+
+// Get returns the value stored for exactly p.
+func (t *Table) Get(p netip.Prefix) (val any, found bool) {
+	return t.tr.Get(prefixKey(p))
+}
+
+// Lookup returns the longest prefix in the table that contains addr.
+// IPv4-mapped IPv6 addresses only match IPv6 prefixes.
+func (t *Table) Lookup(addr netip.Addr) (p netip.Prefix, val any, found bool) {
+	if !addr.IsValid() {
+		return netip.Prefix{}, nil, false
+	}
+	k, v, found := t.tr.LongestPrefix(appendBits(nil, addr, addr.BitLen()))
+	if !found {
+		return netip.Prefix{}, nil, false
+	}
+	return keyPrefix(k), v, true
+}
+
+// Iterator returns an iterator over the prefixes in canonical order: IPv4
+// before IPv6, then by address, then shorter prefixes first.
+func (t *Table) Iterator() *Iterator {
+	return &Iterator{it: t.tr.Iterator()}
+}
+
+// Iterator iterates the prefixes of a Table.
+type Iterator struct {
+	it *qp.Iterator
+}
+
+// Next returns the next prefix and its value, or ok=false at the end.
+func (it *Iterator) Next() (p netip.Prefix, val any, ok bool) {
+	k, v, ok := it.it.Next()
+	if !ok {
+		return netip.Prefix{}, nil, false
+	}
+	return keyPrefix(k), v, true
+}
+
+func prefixKey(p netip.Prefix) []byte {
+	if !p.IsValid() {
+		panic(fmt.Errorf("invalid prefix %v", p))
+	}
+	p = p.Masked()
+	return appendBits(make([]byte, 0, 1+p.Bits()), p.Addr(), p.Bits())
+}
+
+// appendBits appends the family byte and the first n bits of addr, one byte each.
+func appendBits(key []byte, addr netip.Addr, n int) []byte {
+	if addr.Is4() {
+		key = append(key, family4)
+	} else {
+		key = append(key, family6)
+	}
+	a := addr.AsSlice()
+	for i := 0; i < n; i++ {
+		key = append(key, a[i/8]>>(7-i%8)&1)
+	}
+	return key
+}
+
+func keyPrefix(key []byte) netip.Prefix {
+	var a [16]byte
+	bits := key[1:]
+	for i, b := range bits {
+		a[i/8] |= b << (7 - i%8)
+	}
+	var addr netip.Addr
+	if key[0] == family4 {
+		addr = netip.AddrFrom4([4]byte(a[:4]))
+	} else {
+		addr = netip.AddrFrom16(a)
+	}
+	return netip.PrefixFrom(addr, len(bits))
+}
@@ -0,0 +1,128 @@
+package iptable
+
+import (
+	"math/rand"
+	"net/netip"
+	"testing"
+)
+
+func Test_Lookup(t *testing.T) {
+	tbl := New()
+	routes := []string{
+		"0.0.0.0/0",
+		"10.0.0.0/8",
+		"10.128.0.0/9",
+		"10.130.0.0/15",
+		"10.131.255.255/32",
+		"192.168.1.0/24",
+		"::/0",
+		"2001:db8::/32",
+		"2001:db8:8000::/33",
+		"::ffff:0:0/96",
+	}
+	for i, r := range routes {
+		tbl.Insert(netip.MustParsePrefix(r), i)
+	}
+	if tbl.Size() != len(routes) {
+		t.Fatalf("Size got %d want %d", tbl.Size(), len(routes))
+	}
+
+	tests := []struct {
+		addr, expect string
+	}{
+		{"1.2.3.4", "0.0.0.0/0"},
+		{"10.1.2.3", "10.0.0.0/8"},
+		{"10.127.255.255", "10.0.0.0/8"},
+		{"10.128.0.0", "10.128.0.0/9"},
+		{"10.131.0.1", "10.130.0.0/15"},
+		{"10.131.255.255", "10.131.255.255/32"},
+		{"10.132.0.0", "10.128.0.0/9"},
+		{"192.168.1.200", "192.168.1.0/24"},
+		{"192.168.2.1", "0.0.0.0/0"},
+		{"2001:db8::1", "2001:db8::/32"},
+		{"2001:db8:8000::1", "2001:db8:8000::/33"},
+		{"2001:db9::1", "::/0"},
+		{"::ffff:10.1.2.3", "::ffff:0:0/96"},
+	}
+	for _, tt := range tests {
+		p, _, found := tbl.Lookup(netip.MustParseAddr(tt.addr))
+		if !found || p != netip.MustParsePrefix(tt.expect) {
+			t.Errorf("Lookup(%s) got %v, %v want %s", tt.addr, p, found, tt.expect)
+		}
+	}
+
+	tbl.Delete(netip.MustParsePrefix("0.0.0.0/0"))
+	if p, _, found := tbl.Lookup(netip.MustParseAddr("1.2.3.4")); found {
+		t.Errorf("Lookup after deleting the default route got %v", p)
+	}
+	if _, _, found := tbl.Lookup(netip.Addr{}); found {
+		t.Errorf("Lookup of the zero Addr should not match")
+	}
+}
+
+func Test_InsertMasks(t *testing.T) {
+	tbl := New()
+	tbl.Insert(netip.MustParsePrefix("10.1.2.3/8"), 1)
+	if v, found := tbl.Get(netip.MustParsePrefix("10.0.0.0/8")); !found || v != 1 {
+		t.Fatalf("Get got %v, %v", v, found)
+	}
+	if old, isUpdate := tbl.Insert(netip.MustParsePrefix("10.0.0.0/8"), 2); !isUpdate || old != 1 {
+		t.Fatalf("Insert got %v, %v", old, isUpdate)
+	}
+}
+
+func Test_Iterator(t *testing.T) {
+	routes := []string{"::/0", "10.0.0.0/16", "10.0.0.0/8", "9.255.0.0/16", "10.1.0.0/16", "0.0.0.0/0", "10.0.0.0/9", "2001:db8::/32"}
+	expect := []string{"0.0.0.0/0", "9.255.0.0/16", "10.0.0.0/8", "10.0.0.0/9", "10.0.0.0/16", "10.1.0.0/16", "::/0", "2001:db8::/32"}
+	tbl := New()
+	for _, r := range routes {
+		tbl.Insert(netip.MustParsePrefix(r), nil)
+	}
+	it := tbl.Iterator()
+	for _, e := range expect {
+		p, _, ok := it.Next()
+		if !ok || p.String() != e {
+			t.Fatalf("Next got %v, %v want %s", p, ok, e)
+		}
+	}
+	if _, _, ok := it.Next(); ok {
+		t.Fatalf("iterator should be exhausted")
+	}
+}
+
+func Test_LookupRandom(t *testing.T) {
+	rd := rand.New(rand.NewSource(1))
+	randAddr := func(v6 bool) netip.Addr {
+		var a [16]byte
+		rd.Read(a[:])
+		// keep addresses clustered so prefixes nest
+		a[0] &= 0x3
+		if !v6 {
+			return netip.AddrFrom4([4]byte(a[:4]))
+		}
+		return netip.AddrFrom16(a)
+	}
+
+	tbl := New()
+	var prefixes []netip.Prefix
+	for i := 0; i < 2000; i++ {
+		v6 := rd.Intn(2) == 0
+		addr := randAddr(v6)
+		p := netip.PrefixFrom(addr, rd.Intn(addr.BitLen()+1)).Masked()
+		tbl.Insert(p, p)
+		prefixes = append(prefixes, p)
+	}
+	for i := 0; i < 2000; i++ {
+		addr := randAddr(rd.Intn(2) == 0)
+		var best netip.Prefix
+		for _, p := range prefixes {
+			if p.Contains(addr) && (!best.IsValid() || p.Bits() > best.Bits()) {
+				best = p
+			}
+		}
+		p, v, found := tbl.Lookup(addr)
+		if found != best.IsValid() || (found && (p != best || v != best)) {
+			t.Fatalf("Lookup(%v) got %v, %v want %v", addr, p, found, best)
+		}
+	}
+}
@@ -1,89 +1,152 @@
 package qp
 
-const initIterStackSize = 256
+import "bytes"
 
+const initIterStackSize = 32
+
+// iterFrame is a branch on the path to the current leaf and the offset of the
+// twig the path takes.
+type iterFrame[V any] struct {
+	bn *gnode[V]
+	i  int
+}
+
+// Iterator walks the keys of a trie in lexicographical order.
+// The zero Iterator is ready for Reset. An Iterator can be reused with Reset
+// and Seek; once its stack has grown to the depth of the trie it does not
+// allocate again.
 type Iterator struct {
-	tr    *Trie
-	stack []*trieNode
-	idx   int // stack index
+	iter[any]
+}
+
+// iter walks the leaves of a Trie or a Set.
+type iter[V any] struct {
+	tr    *trie[V]
+	stack []iterFrame[V]
+	leaf  *gnode[V] // next leaf returned by Next, nil when exhausted
 }
 
 // Iterator returns a new iterator for traversing the trie.
 // The iterator starts at the root node and can be used to iterate
 // through all key-value pairs stored in the trie in lexicographical order.
-// Returns nil if the trie is empty.
 func (tr *Trie) Iterator() *Iterator {
 	var it Iterator
+	it.Reset(tr)
+	return &it
+}
+
+// Reset positions the iterator at the first key of tr.
+func (it *Iterator) Reset(tr *Trie) {
+	it.reset(&tr.trie)
+}
+
+func (it *iter[V]) reset(tr *trie[V]) {
 	it.tr = tr
-	it.stack = make([]*trieNode, initIterStackSize)
-	it.stack[0] = &tr.root
-	if tr.size > 0 {
-		it.idx = 1
+	if it.stack == nil {
+		it.stack = make([]iterFrame[V], 0, initIterStackSize)
 	}
-	if it.idx == 0 {
-		return &it
+	it.stack = it.stack[:0]
+	it.leaf = nil
+	if !tr.root.isNil() {
+		it.descendFirst(&tr.root)
 	}
+}
 
-	return &it
+// Seek positions the iterator at the first key that is greater than or equal to key.
+func (it *Iterator) Seek(key []byte) {
+	must(key)
+	it.seek(key)
+}
+
+func (it *iter[V]) seek(key []byte) {
+	it.stack = it.stack[:0]
+	it.leaf = nil
+	tr := it.tr
+	if tr.root.isNil() {
+		return
+	}
+
+	leaf := tr.findMatch(key, false)
+	index, match := nibbleIndex(key, leaf.key())
+	n := &tr.root
+	for n.isBranch() && (match || n.index() < index) {
+		i := n.twigOffset(n.twigBit(key))
+		it.stack = append(it.stack, iterFrame[V]{n, i})
+		n = n.twig(i)
+	}
+	if match {
+		it.leaf = n
+		return
+	}
+
+	if n.isBranch() && n.index() == index {
+		// key would be a new twig of n: continue with the twigs after it.
+		i := n.twigOffset(n.twigBit(key))
+		if i < n.twigOffsetMax() {
+			it.stack = append(it.stack, iterFrame[V]{n, i})
+			it.descendFirst(n.twig(i))
+			return
+		}
+		it.advance()
+		return
+	}
+
+	// All keys under n agree with leaf up to index, so key sorts either before
+	// or after all of them.
+	if nibbleBit(index, key) < nibbleBit(index, leaf.key()) {
+		it.descendFirst(n)
+		return
+	}
+	it.advance()
+}
+
+// seekAfter positions the iterator at the first key that is greater than key,
+// which may be of any length.
+func (it *iter[V]) seekAfter(key []byte) {
+	if len(key) == 0 {
+		it.reset(it.tr)
+		return
+	}
+	// No key lies between a key too long to store and its longest prefix
+	// that can be stored, other than that prefix.
+	key = key[:min(len(key), maxKeyBytes)]
+	it.seek(key)
+	if it.leaf != nil && bytes.Equal(it.leaf.key(), key) {
+		it.advance()
+	}
 }
 
 // Next returns the next key-value pair in the iterator's sequence.
 // If there are no more items to return, ok will be false.
 // The returned key and value should not be modified by the caller.
 func (it *Iterator) Next() (key []byte, value any, ok bool) {
-	if it.idx <= 0 {
+	leaf := it.leaf
+	if leaf == nil {
 		return nil, nil, false
 	}
-	if it.tr.Size() == 1 {
-		leaf := it.tr.root.(*leafNode)
-		it.idx = 0
-		return leaf.key, leaf.value, true
-	}
-	return it.nextLeaf()
+	it.advance()
+	return leaf.key(), leaf.val, true
 }
 
-func (it *Iterator) push(n *trieNode) {
-	if it.idx >= len(it.stack) {
-		it.stack = append(it.stack, nil)
-	}
-	it.stack[it.idx] = n
-	it.idx++
-}
-
-func (it *Iterator) firstLeaf() (key []byte, value any, ok bool) {
-	for {
-		n := it.stack[it.idx-1]
-		switch (*n).(type) {
-		case *branchNode:
-			bn := (*n).(*branchNode)
-			nextNode := bn.twig(0)
-			it.push(nextNode)
-		case *leafNode:
-			leaf := (*n).(*leafNode)
-			return leaf.key, leaf.value, true
-		}
+// descendFirst makes the leftmost leaf under n the next leaf.
+func (it *iter[V]) descendFirst(n *gnode[V]) {
+	for n.isBranch() {
+		it.stack = append(it.stack, iterFrame[V]{n, 0})
+		n = n.twig(0)
 	}
+	it.leaf = n
 }
 
-func (it *Iterator) nextLeaf() (key []byte, value any, ok bool) {
-	n := it.stack[it.idx-1]
-	switch (*n).(type) {
-	case *branchNode:
-		return it.firstLeaf()
-	case *leafNode:
-		for ; it.idx >= 2; it.idx-- {
-			n = it.stack[it.idx-1]
-			p := it.stack[it.idx-2]
-			bn := (*p).(*branchNode)
-			tIdx := bn.twigIdx(*n)
-			if bn.twigTail(tIdx) {
-				continue
-			}
-
-			it.stack[it.idx-1] = bn.twig(tIdx + 1)
-			return it.firstLeaf()
+// advance moves to the leaf after the subtree the top frame points into.
+func (it *iter[V]) advance() {
+	for len(it.stack) > 0 {
+		top := &it.stack[len(it.stack)-1]
+		if top.i+1 < top.bn.twigOffsetMax() {
+			top.i++
+			it.descendFirst(top.bn.twig(top.i))
+			return
 		}
+		it.stack = it.stack[:len(it.stack)-1]
 	}
-	it.idx = 0
-	return nil, nil, false
+	it.leaf = nil
 }
@@ -2,6 +2,7 @@ package qp
 
 import (
 	"bytes"
+	"sort"
 	"testing"
 )
 
@@ -110,3 +111,115 @@ func Test_WordsIter(t *testing.T) {
 		t.Fatalf("iter counter not match")
 	}
 }
+
+func Test_IterSeek(t *testing.T) {
+	sortedWords := loadTestData(wordsSortedPath)
+	tr := New()
+	for _, w := range sortedWords[:20000] {
+		tr.Upsert(w, value1)
+	}
+	keys := sortedWords[:20000]
+
+	var it Iterator
+	it.Reset(tr)
+	seeks := [][]byte{{0}, {0xff}, []byte("A"), []byte("Aa"), []byte("aa"), []byte("ab\x00"), []byte("zzz")}
+	for i := 0; i < len(keys); i += 97 {
+		seeks = append(seeks, keys[i], append(append([]byte{}, keys[i]...), 0), keys[i][:len(keys[i])-1])
+	}
+	for _, s := range seeks {
+		if len(s) == 0 {
+			continue
+		}
+		it.Seek(s)
+		idx := sort.Search(len(keys), func(i int) bool { return bytes.Compare(keys[i], s) >= 0 })
+		for j := 0; j < 3; j++ {
+			k, _, ok := it.Next()
+			if idx+j >= len(keys) {
+				if ok {
+					t.Fatalf("Seek(%q) step %d got %q want end", s, j, k)
+				}
+				break
+			}
+			if !ok || !bytes.Equal(k, keys[idx+j]) {
+				t.Fatalf("Seek(%q) step %d got %q want %q", s, j, k, keys[idx+j])
+			}
+		}
+	}
+}
+
+func Test_IterSeekNoByte(t *testing.T) {
+	data := []string{"c\000a", "c\000a\000b", "c\000b", "c\000abc", "d\000a", "e\000abc"}
+	tr := New()
+	for _, d := range data {
+		tr.Upsert([]byte(d), value1)
+	}
+	sort.Strings(data)
+	it := tr.Iterator()
+	for _, s := range []string{"c", "c\000", "c\000a", "c\000a\000", "c\000ab", "c\000abd", "d", "e\000abcd", "f"} {
+		it.Seek([]byte(s))
+		idx := sort.SearchStrings(data, s)
+		k, _, ok := it.Next()
+		if idx == len(data) {
+			if ok {
+				t.Fatalf("Seek(%q) got %q want end", s, k)
+			}
+			continue
+		}
+		if !ok || string(k) != data[idx] {
+			t.Fatalf("Seek(%q) got %q want %q", s, k, data[idx])
+		}
+	}
+}
+
+func Test_IterReuse(t *testing.T) {
+	words := loadTestData(wordsPath)
+	tr1 := New()
+	for _, w := range words[:1000] {
+		tr1.Upsert(w, value1)
+	}
+	tr2 := New()
+	tr2.Upsert([]byte("x"), value2)
+
+	var it Iterator
+	it.Reset(tr1)
+	scan := func() {
+		it.Reset(tr1)
+		it.Seek(words[500])
+		for i := 0; i < 10; i++ {
+			it.Next()
+		}
+		it.Reset(tr2)
+		if k, _, ok := it.Next(); !ok || string(k) != "x" {
+			t.Fatalf("Next after Reset got %q, %v", k, ok)
+		}
+		if _, _, ok := it.Next(); ok {
+			t.Fatalf("Next should be exhausted")
+		}
+	}
+	if allocs := testing.AllocsPerRun(100, scan); allocs != 0 {
+		t.Fatalf("allocs per scan = %v, want 0", allocs)
+	}
+
+	it.Reset(New())
+	if _, _, ok := it.Next(); ok {
+		t.Fatalf("empty trie should have no keys")
+	}
+}
+
+func Benchmark_Iter_ShortScan(b *testing.B) {
+	words := loadTestData(wordsSortedPath)
+	tr := New()
+	for _, w := range words {
+		tr.Upsert(w, nil)
+	}
+	var it Iterator
+	it.Reset(tr)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		it.Seek(words[(i*7919)%len(words)])
+		for j := 0; j < 10; j++ {
+			it.Next()
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package qp
+
+import "bytes"
+
+// ListResult is a page of keys returned by List.
+// Its keys and common prefixes should not be modified by the caller.
+type ListResult struct {
+	// Pairs holds the keys under the prefix that contain no delimiter after it.
+	Pairs []KVPair
+	// CommonPrefixes holds the distinct key prefixes up to and including the
+	// first delimiter after the prefix, standing for all keys that start with them.
+	CommonPrefixes [][]byte
+	// Truncated reports whether more entries follow; pass NextStartAfter as
+	// startAfter to List to get them.
+	Truncated      bool
+	NextStartAfter []byte
+}
+
+// List lists the keys starting with prefix like an object store lists a
+// bucket. Keys that contain delimiter after the prefix are rolled up into one
+// common prefix each, and the keys under a common prefix are skipped with a
+// seek instead of being iterated. Only keys and common prefixes greater than
+// startAfter are returned, at most max of them together, in key order.
+// An empty delimiter lists every key under the prefix. If max <= 0, or no key
+// can start with prefix, the result is empty and not truncated.
+func (tr *Trie) List(prefix, delimiter, startAfter []byte, max int) ListResult {
+	var res ListResult
+	if max <= 0 || len(prefix) > maxKeyBytes {
+		return res
+	}
+	it := tr.Iterator()
+	switch {
+	case bytes.Compare(startAfter, prefix) >= 0:
+		it.seekAfter(startAfter)
+	case len(prefix) > 0:
+		it.Seek(prefix)
+	}
+
+	n := 0
+	for {
+		k, v, ok := it.Next()
+		if !ok || !bytes.HasPrefix(k, prefix) {
+			break
+		}
+		var cp []byte
+		if len(delimiter) > 0 {
+			if i := bytes.Index(k[len(prefix):], delimiter); i >= 0 {
+				cp = k[: len(prefix)+i+len(delimiter) : len(prefix)+i+len(delimiter)]
+			}
+		}
+		if cp != nil && bytes.Compare(cp, startAfter) <= 0 {
+			// startAfter is inside this common prefix, which was listed before.
+			if !seekPast(it, cp) {
+				break
+			}
+			continue
+		}
+		if n == max {
+			res.Truncated = true
+			break
+		}
+		n++
+		if cp == nil {
+			res.Pairs = append(res.Pairs, KVPair{Key: k, Value: v})
+			res.NextStartAfter = k
+			continue
+		}
+		res.CommonPrefixes = append(res.CommonPrefixes, cp)
+		res.NextStartAfter = cp
+		if !seekPast(it, cp) {
+			break
+		}
+	}
+	if !res.Truncated {
+		res.NextStartAfter = nil
+	}
+	return res
+}
+
+// seekPast positions it after every key starting with p and reports whether
+// any key can follow.
+func seekPast(it *Iterator, p []byte) bool {
+	next := bytes.TrimRight(p, "\xff")
+	if len(next) == 0 {
+		return false
+	}
+	next = bytes.Clone(next)
+	next[len(next)-1]++
+	it.Seek(next)
+	return true
+}
@@ -0,0 +1,143 @@
+package qp
+
+import (
+	"bytes"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func Test_List(t *testing.T) {
+	tr := New()
+	for _, k := range []string{
+		"photos/2006/January/sample.jpg",
+		"photos/2006/February/sample2.jpg",
+		"photos/2006/February/sample3.jpg",
+		"photos/2006/index.html",
+		"photos/2007/x.jpg",
+		"photos/readme",
+		"photosx",
+		"videos/a.mp4",
+	} {
+		tr.Upsert([]byte(k), k)
+	}
+
+	res := tr.List([]byte("photos/"), []byte("/"), nil, 10)
+	checkList(t, res, []string{"photos/readme"}, []string{"photos/2006/", "photos/2007/"}, false)
+
+	res = tr.List([]byte("photos/2006/"), []byte("/"), nil, 10)
+	checkList(t, res, []string{"photos/2006/index.html"}, []string{"photos/2006/February/", "photos/2006/January/"}, false)
+
+	res = tr.List(nil, []byte("/"), nil, 10)
+	checkList(t, res, []string{"photosx"}, []string{"photos/", "videos/"}, false)
+
+	res = tr.List([]byte("photos/2006/"), nil, nil, 2)
+	checkList(t, res, []string{"photos/2006/February/sample2.jpg", "photos/2006/February/sample3.jpg"}, nil, true)
+
+	// Paging resumes after a common prefix without listing it again.
+	res = tr.List([]byte("photos/"), []byte("/"), nil, 1)
+	checkList(t, res, nil, []string{"photos/2006/"}, true)
+	res = tr.List([]byte("photos/"), []byte("/"), res.NextStartAfter, 1)
+	checkList(t, res, nil, []string{"photos/2007/"}, true)
+	res = tr.List([]byte("photos/"), []byte("/"), res.NextStartAfter, 1)
+	checkList(t, res, []string{"photos/readme"}, nil, false)
+
+	res = tr.List([]byte("photos/"), []byte("/"), []byte("photos/2006/January/x"), 10)
+	checkList(t, res, []string{"photos/readme"}, []string{"photos/2007/"}, false)
+
+	res = tr.List(nil, nil, nil, 0)
+	checkList(t, res, nil, nil, false)
+
+	// startAfter may be as long as a key can be, or longer.
+	long := bytes.Repeat([]byte("v"), maxKeyBytes)
+	tr.Upsert(long, nil)
+	tr.Upsert([]byte("w"), nil)
+	res = tr.List(nil, nil, long[:maxKeyBytes-1], 10)
+	checkList(t, res, []string{string(long), "w"}, nil, false)
+	res = tr.List(nil, nil, long, 10)
+	checkList(t, res, []string{"w"}, nil, false)
+	res = tr.List(nil, nil, append(long, 0), 10)
+	checkList(t, res, []string{"w"}, nil, false)
+	res = tr.List(append(long, 0), nil, nil, 10)
+	checkList(t, res, nil, nil, false)
+}
+
+func Test_ListRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	const alphabet = "ab/\xff"
+	randKey := func(n int) []byte {
+		key := make([]byte, n)
+		for i := range key {
+			key[i] = alphabet[r.Intn(len(alphabet))]
+		}
+		return key
+	}
+	for range 300 {
+		tr := New()
+		var keys []string
+		for range r.Intn(80) {
+			k := randKey(1 + r.Intn(5))
+			if _, isUpdate := tr.Upsert(k, nil); !isUpdate {
+				keys = append(keys, string(k))
+			}
+		}
+		slices.Sort(keys)
+		prefix, delim := randKey(r.Intn(2)), randKey(r.Intn(2))
+
+		// The slow way: every entry in order.
+		var want []string
+		for _, k := range keys {
+			if !bytes.HasPrefix([]byte(k), prefix) {
+				continue
+			}
+			e := k
+			if len(delim) > 0 {
+				if i := bytes.Index([]byte(k[len(prefix):]), delim); i >= 0 {
+					e = k[:len(prefix)+i+len(delim)]
+				}
+			}
+			if len(want) == 0 || want[len(want)-1] != e {
+				want = append(want, e)
+			}
+		}
+
+		var got []string
+		var startAfter []byte
+		for page := 0; ; page++ {
+			res := tr.List(prefix, delim, startAfter, 1+r.Intn(3))
+			var entries []string
+			for _, p := range res.Pairs {
+				entries = append(entries, string(p.Key))
+			}
+			for _, cp := range res.CommonPrefixes {
+				entries = append(entries, string(cp))
+			}
+			slices.Sort(entries)
+			got = append(got, entries...)
+			if !res.Truncated {
+				break
+			}
+			startAfter = res.NextStartAfter
+			if page > len(keys)+1 {
+				t.Fatal("List does not make progress")
+			}
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("prefix %q delimiter %q: got %q want %q", prefix, delim, got, want)
+		}
+	}
+}
+
+func checkList(t *testing.T, res ListResult, keys, prefixes []string, truncated bool) {
+	t.Helper()
+	var gotKeys, gotPrefixes []string
+	for _, p := range res.Pairs {
+		gotKeys = append(gotKeys, string(p.Key))
+	}
+	for _, p := range res.CommonPrefixes {
+		gotPrefixes = append(gotPrefixes, string(p))
+	}
+	if !slices.Equal(gotKeys, keys) || !slices.Equal(gotPrefixes, prefixes) || res.Truncated != truncated {
+		t.Fatalf("got %q %q %v want %q %q %v", gotKeys, gotPrefixes, res.Truncated, keys, prefixes, truncated)
+	}
+}
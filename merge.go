@@ -0,0 +1,20 @@
+package qp
+
+// ResolveFn picks the value kept for a key present in both tries passed to Merge.
+type ResolveFn = func(key []byte, va, vb any) any
+
+// Merge returns a trie with the keys of both a and b. Subtrees holding keys of
+// only one side are shared with it copy-on-write instead of copied, and
+// resolve is called only for keys present in both. If resolve is nil, the
+// value of b wins. The result has the options of a; neither a nor b is
+// changed, now or by later changes to the result.
+func Merge(a, b *Trie, resolve ResolveFn) *Trie {
+	if resolve == nil {
+		resolve = func(_ []byte, _, vb any) any { return vb }
+	}
+	return a.union(b, func(la, lb *node) node {
+		var r node
+		r.setLeaf(la.key(), resolve(la.key(), la.val, lb.val))
+		return r
+	})
+}
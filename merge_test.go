@@ -0,0 +1,79 @@
+package qp
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func Test_Merge(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for round := range 200 {
+		a, b := New(), New()
+		ma, mb := map[string]any{}, map[string]any{}
+		for range r.Intn(50) {
+			k := fmt.Sprintf("%x", r.Intn(80))
+			a.Upsert([]byte(k), r.Intn(10))
+			ma[k], _ = a.Get([]byte(k))
+		}
+		for range r.Intn(50) {
+			k := fmt.Sprintf("%x", r.Intn(80))
+			b.Upsert([]byte(k), r.Intn(10))
+			mb[k], _ = b.Get([]byte(k))
+		}
+		if round%4 == 0 {
+			b = a.snapshot()
+			mb = map[string]any{}
+			for k, v := range ma {
+				mb[k] = v
+			}
+			b.Upsert([]byte("zz"), 1)
+			mb["zz"] = 1
+		}
+
+		calls := 0
+		m := Merge(a, b, func(k []byte, va, vb any) any {
+			calls++
+			if _, ok := ma[string(k)]; !ok {
+				t.Fatalf("resolve called for %q, not in a", k)
+			}
+			return va.(int)*100 + vb.(int)
+		})
+		want := map[string]any{}
+		common := 0
+		for k, v := range ma {
+			want[k] = v
+		}
+		for k, v := range mb {
+			if va, ok := ma[k]; ok {
+				want[k] = va.(int)*100 + v.(int)
+				common++
+			} else {
+				want[k] = v
+			}
+		}
+		if calls != common {
+			t.Fatalf("resolve called %d times want %d", calls, common)
+		}
+		if err := m.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		checkTrie(t, m, want)
+
+		for k := range want {
+			m.Upsert([]byte(k), -1)
+		}
+		checkTrie(t, a, ma)
+		checkTrie(t, b, mb)
+	}
+}
+
+func Test_MergeDefault(t *testing.T) {
+	a, b := New(), New()
+	a.Upsert([]byte("a"), value1)
+	a.Upsert([]byte("b"), value1)
+	b.Upsert([]byte("b"), value2)
+	b.Upsert([]byte("c"), value2)
+	checkTrie(t, Merge(a, b, nil), map[string]any{"a": value1, "b": value2, "c": value2})
+	checkTrie(t, Merge(New(), b, nil), map[string]any{"b": value2, "c": value2})
+}
@@ -0,0 +1,113 @@
+package qp
+
+import "bytes"
+
+// MovePrefix renames every key starting with from to start with to instead,
+// and returns the number of keys moved. Moved keys replace existing keys of
+// the same name; values are moved as they are, without calling the handlers.
+//
+// The subtree under from is rebuilt once with its branches shifted to the new
+// key length, instead of deleting and inserting each key, and is then linked
+// in with the rest of the trie. Both prefixes must not be empty.
+func (tr *Trie) MovePrefix(from, to []byte) int {
+	must(from)
+	must(to)
+	sub := tr.findPrefix(from)
+	if sub == nil {
+		return 0
+	}
+	if bytes.Equal(from, to) {
+		return countLeaves(sub)
+	}
+
+	moved := tr.relocate(sub, len(from), to)
+	tr.own()
+	tr.root.markCow()
+	cut := *sub
+	var m merger[any]
+	rest, n := m.difference(&tr.root, &cut)
+	if tr.arena != nil {
+		freeKeys(tr.arena, sub)
+		defer tr.maybeCompactKeys()
+	}
+	tr.link(rest, moved, tr.size-n, n)
+	return n
+}
+
+// Graft inserts every key of other under prefix, as prefix+key, and returns
+// the number of keys grafted. Grafted keys replace existing keys of the same
+// name; values are copied as they are, without calling the handlers.
+// The nodes of other are rebuilt in one pass rather than inserted one by one,
+// and other is not changed.
+func (tr *Trie) Graft(prefix []byte, other *Trie) int {
+	if other.root.isNil() {
+		return 0
+	}
+	moved := tr.relocate(&other.root, 0, prefix)
+	tr.link(tr.root, moved, tr.size, other.size)
+	return other.size
+}
+
+// MovePrefix is Trie.MovePrefix within the transaction.
+func (tx *Txn) MovePrefix(from, to []byte) int {
+	return tx.newTr.MovePrefix(from, to)
+}
+
+// Graft is Trie.Graft within the transaction.
+func (tx *Txn) Graft(prefix []byte, other *Trie) int {
+	return tx.newTr.Graft(prefix, other)
+}
+
+// link makes the root of tr the union of rest and moved, which hold size and
+// n keys. Keys of moved win.
+func (tr *Trie) link(rest, moved node, size, n int) {
+	if rest.isNil() {
+		tr.root, tr.size = moved, n
+		return
+	}
+	rest.markCow()
+	m := merger[any]{pool: tr.pool, resolve: func(_, b *node) node { return *b }}
+	tr.root = m.union(&rest, &moved)
+	tr.size = size + n - m.common
+}
+
+// relocate returns a private copy of the subtree n with the first cut bytes
+// of every key replaced by to. Branch indexes move by the change in length;
+// nibbles and so bitmaps stay the same.
+func (tr *Trie) relocate(n *node, cut int, to []byte) node {
+	var r node
+	if !n.isBranch() {
+		old := n.key()
+		size := len(to) + len(old) - cut
+		if size > maxKeyBytes {
+			panic(errKeyTooLong)
+		}
+		var key []byte
+		if tr.arena != nil {
+			key = tr.arena.reserve(size)
+		} else {
+			key = make([]byte, size)
+		}
+		copy(key[copy(key, to):], old[cut:])
+		r.setLeaf(key, n.val)
+		return r
+	}
+	old := n.twigs()
+	twigs := tr.pool.get(len(old))
+	for i := range old {
+		twigs[i] = tr.relocate(&old[i], cut, to)
+	}
+	index := int(n.index()) + 2*(len(to)-cut)
+	r.setBranch(twigs, nibbleIndexT(index), n.bitmap())
+	return r
+}
+
+func freeKeys(a *keyArena, n *node) {
+	if !n.isBranch() {
+		a.free(n.key())
+		return
+	}
+	for i := range n.twigOffsetMax() {
+		freeKeys(a, n.twig(i))
+	}
+}
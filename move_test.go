@@ -0,0 +1,94 @@
+package qp
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func Test_MovePrefix(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	const alphabet = "\x00\x01\x0f\x10\x11ab\xff"
+	randKey := func(n int) []byte {
+		key := make([]byte, n)
+		for i := range key {
+			key[i] = alphabet[r.Intn(len(alphabet))]
+		}
+		return key
+	}
+	for round := range 500 {
+		var opts []Option
+		if round%2 == 1 {
+			opts = append(opts, WithNodePool())
+		}
+		if round%3 == 1 {
+			opts = append(opts, WithKeyArena())
+		}
+		tr := New(opts...)
+		m := map[string]any{}
+		for range r.Intn(60) {
+			key := randKey(1 + r.Intn(4))
+			tr.Upsert(key, round)
+			m[string(key)] = round
+		}
+		from, to := randKey(1+r.Intn(2)), randKey(1+r.Intn(3))
+
+		want := map[string]any{}
+		moved := 0
+		for k, v := range m {
+			if !bytes.HasPrefix([]byte(k), from) {
+				want[k] = v
+			}
+		}
+		for k, v := range m {
+			if bytes.HasPrefix([]byte(k), from) {
+				want[string(to)+k[len(from):]] = v
+				moved++
+			}
+		}
+
+		snap := tr.snapshot()
+		if n := tr.MovePrefix(from, to); n != moved {
+			t.Fatalf("MovePrefix(%q, %q) moved %d want %d", from, to, n, moved)
+		}
+		if err := tr.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		checkTrie(t, tr, want)
+		checkTrie(t, snap, m)
+	}
+}
+
+func Test_Graft(t *testing.T) {
+	tr := New()
+	tr.Upsert([]byte("/a"), value1)
+	tr.Upsert([]byte("/p/x"), value1)
+	tr.Upsert([]byte("/q"), value1)
+	other := New()
+	other.Upsert([]byte("x"), value2)
+	other.Upsert([]byte("y"), value2)
+	other.Upsert([]byte("yz"), value2)
+
+	tx := tr.Txn()
+	if n := tx.Graft([]byte("/p/"), other); n != 3 {
+		t.Fatalf("Graft got %d want 3", n)
+	}
+	checkTrie(t, tr, map[string]any{"/a": value1, "/p/x": value1, "/q": value1})
+	tr = tx.Commit()
+	if err := tr.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	checkTrie(t, tr, map[string]any{"/a": value1, "/p/x": value2, "/p/y": value2, "/p/yz": value2, "/q": value1})
+	checkTrie(t, other, map[string]any{"x": value2, "y": value2, "yz": value2})
+
+	tx = tr.Txn()
+	if n := tx.MovePrefix([]byte("/p/"), []byte("/projects/b/")); n != 3 {
+		t.Fatalf("MovePrefix got %d want 3", n)
+	}
+	tr = tx.Commit()
+	checkTrie(t, tr, map[string]any{"/a": value1, "/projects/b/x": value2, "/projects/b/y": value2, "/projects/b/yz": value2, "/q": value1})
+
+	empty := New()
+	empty.Graft([]byte("p"), other)
+	checkTrie(t, empty, map[string]any{"px": value2, "py": value2, "pyz": value2})
+}
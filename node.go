@@ -1,146 +1,225 @@
 package qp
 
-import "math/bits"
-
-type trieNode interface {
-	isBranch() bool
-	// cow
-	dup() trieNode
-	cowMarked() bool
-	markCow()
-	clearCow()
-}
-
-type leafNode struct {
-	key   []byte
-	value any
-	cow   bool
-}
-
-func (*leafNode) isBranch() bool {
-	return false
-}
-
-func (ln *leafNode) dup() trieNode {
-	return &leafNode{key: ln.key, value: ln.value, cow: ln.cow}
-}
-
-func (ln *leafNode) cowMarked() bool {
-	return ln.cow
+import (
+	"math/bits"
+	"unsafe"
+)
+
+// node is either a leaf or a branch, told apart by branchFlag.
+//
+// A leaf embeds its key and value: ptr points at the first key byte and word
+// holds the key length. A branch packs its nibble index, the number of leaves
+// below it and its bitmap into word, and ptr points at its twigs, a compact
+// array of popcount(bitmap) nodes in nibble order. Leaves live directly in their parent's twig array, so a key
+// costs one node and no separate allocation.
+//
+// cowFlag on a branch means its twig array may be shared with another trie and
+// has to be copied before it is modified.
+//
+// The value type is a parameter so that a Set, whose leaves hold no value, has
+// nodes of two words. val comes first: a trailing zero-size field is padded.
+type gnode[V any] struct {
+	val  V
+	ptr  unsafe.Pointer
+	word uint64
+}
+
+// node is the node of a Trie.
+type node = gnode[any]
+
+const (
+	branchFlag uint64 = 1 << 63
+	cowFlag    uint64 = 1 << 62
+
+	indexShift = 46
+	countShift = 17
+	// countMax is the largest count a branch holds. A branch with countMax
+	// leaves or more has this count, which is not kept up to date.
+	countMax   = 1<<29 - 1
+	bitmapMask = 1<<17 - 1
+	keyLenMask = 1<<32 - 1
+)
+
+func (n *gnode[V]) isNil() bool {
+	return n.ptr == nil
+}
+
+func (n *gnode[V]) isBranch() bool {
+	return n.word&branchFlag != 0
+}
+
+// leaf
+
+func (n *gnode[V]) setLeaf(key []byte, val V) {
+	n.ptr = unsafe.Pointer(unsafe.SliceData(key))
+	n.word = uint64(len(key))
+	n.val = val
+}
+
+func (n *gnode[V]) key() []byte {
+	return unsafe.Slice((*byte)(n.ptr), n.word&keyLenMask)
+}
+
+// branch
+
+// setBranch makes n a branch over twigs, which must be filled in already, as
+// their counts are summed.
+func (n *gnode[V]) setBranch(twigs []gnode[V], index nibbleIndexT, bitmap bitmapT) {
+	c := 0
+	for i := range twigs {
+		c += twigs[i].count()
+	}
+	n.ptr = unsafe.Pointer(unsafe.SliceData(twigs))
+	n.word = branchFlag | uint64(index)<<indexShift | uint64(min(c, countMax))<<countShift | uint64(bitmap)
+	var zero V
+	n.val = zero
 }
 
-func (ln *leafNode) markCow() {
-	ln.cow = true
+func (n *gnode[V]) index() nibbleIndexT {
+	return nibbleIndexT(n.word >> indexShift)
 }
 
-func (ln *leafNode) clearCow() {
-	ln.cow = false
+// count returns the number of leaves under n, or countMax if there are that
+// many or more.
+func (n *gnode[V]) count() int {
+	if !n.isBranch() {
+		return 1
+	}
+	return int(n.word >> countShift & countMax)
 }
 
-type branchNode struct {
-	twigs  []trieNode   // up to 17 twigs, 0th is NO_BYTE
-	bitmap bitmapT      // store which slot is not-NULL
-	index  nibbleIndexT // nibble index, start from 0
-	// cow
-	cow bool
+// addCount adds d to the count of the branch n, unless it is countMax.
+func (n *gnode[V]) addCount(d int) {
+	c := n.count()
+	if c == countMax {
+		return
+	}
+	n.word = n.word&^(countMax<<countShift) | uint64(min(c+d, countMax))<<countShift
 }
 
-func (*branchNode) isBranch() bool {
-	return true
+func (n *gnode[V]) bitmap() bitmapT {
+	return bitmapT(n.word & bitmapMask)
 }
 
-func (bn *branchNode) dup() trieNode {
-	var newBn branchNode
-	newBn.twigs = make([]trieNode, len(bn.twigs))
-	copy(newBn.twigs, bn.twigs)
-	newBn.index = bn.index
-	newBn.bitmap = bn.bitmap
-	newBn.cow = bn.cow
-	return &newBn
+func (n *gnode[V]) twigs() []gnode[V] {
+	return unsafe.Slice((*gnode[V])(n.ptr), n.twigOffsetMax())
 }
 
-func (bn *branchNode) markTwigs() {
-	for _, twig := range bn.twigs {
-		twig.markCow()
-	}
+func (n *gnode[V]) hasTwig(b bitmapT) bool {
+	return n.bitmap()&b > 0
 }
 
-func (bn *branchNode) cowMarked() bool {
-	return bn.cow
+func (n *gnode[V]) twigOffset(b bitmapT) int {
+	w := n.bitmap() & (b - 1)
+	return bits.OnesCount32(w)
 }
 
-func (bn *branchNode) markCow() {
-	bn.cow = true
+func (n *gnode[V]) twig(i int) *gnode[V] {
+	return (*gnode[V])(unsafe.Add(n.ptr, uintptr(i)*unsafe.Sizeof(*n)))
 }
 
-func (bn *branchNode) clearCow() {
-	bn.cow = false
+func (n *gnode[V]) twigOffsetMax() int {
+	return bits.OnesCount32(n.bitmap())
 }
 
-func (bn *branchNode) hasTwig(b bitmapT) bool {
-	return bn.bitmap&b > 0
+func (n *gnode[V]) twigBit(key []byte) bitmapT {
+	return nibbleBit(n.index(), key)
 }
 
-func (bn *branchNode) twigOffset(b bitmapT) int {
-	w := bn.bitmap & (b - 1)
-	return bits.OnesCount16(uint16(w))
-}
+// cow
 
-func (bn *branchNode) twig(i int) *trieNode {
-	return &bn.twigs[i]
+func (n *gnode[V]) cowMarked() bool {
+	return n.word&cowFlag != 0
 }
 
-func (bn *branchNode) twigOffsetMax() int {
-	return bits.OnesCount32(bn.bitmap)
+// markCow marks a branch as sharing its twigs. Leaves own nothing that is
+// modified in place, so they are never marked.
+func (n *gnode[V]) markCow() {
+	if n.isBranch() {
+		n.word |= cowFlag
+	}
 }
 
-func (bn *branchNode) twigBit(key []byte) bitmapT {
-	return nibbleBit(bn.index, key)
+func (n *gnode[V]) clearCow() {
+	n.word &^= cowFlag
 }
 
-func (bn *branchNode) twigIdx(child trieNode) int {
-	for i := range bn.twigs {
-		if child == bn.twigs[i] {
-			return i
+// copyTwigs copies src into dst. If src belongs to a shared array, the
+// branches copied out of it share their own twigs from now on.
+func copyTwigs[V any](dst, src []gnode[V], shared bool) {
+	copy(dst, src)
+	if shared {
+		for i := range dst {
+			dst[i].markCow()
 		}
 	}
-	return -1
 }
 
-func (bn *branchNode) twigTail(twigIdx int) bool {
-	return twigIdx+1 >= bn.twigOffsetMax()
+// unshare gives a cow-marked branch a private copy of its twigs.
+func (n *gnode[V]) unshare(p *twigPool[V]) {
+	if !n.cowMarked() {
+		return
+	}
+	twigs := p.get(n.twigOffsetMax())
+	copyTwigs(twigs, n.twigs(), true)
+	n.setBranch(twigs, n.index(), n.bitmap())
 }
 
-func (bn *branchNode) growTwigs(index nibbleIndexT, newKey []byte, newLeaf *leafNode) {
+// growTwigs adds newLeaf to the twigs of n and returns where it was put.
+func (n *gnode[V]) growTwigs(p *twigPool[V], index nibbleIndexT, newKey []byte, newLeaf *gnode[V]) *gnode[V] {
 	b := nibbleBit(index, newKey)
-	twigOffset := bn.twigOffset(b)
-	bn.twigs = append(bn.twigs, nil)
-	copy(bn.twigs[twigOffset+1:], bn.twigs[twigOffset:])
-	bn.twigs[twigOffset] = newLeaf
-	bn.bitmap |= b
-}
-
-func (bn *branchNode) removeTwig(b bitmapT) {
-	twigOffset := bn.twigOffset(b)
-	copy(bn.twigs[twigOffset:], bn.twigs[twigOffset+1:])
-	bn.twigs[len(bn.twigs)-1] = nil
-	bn.bitmap &= ^b
-}
-
-func newBranchNode(n trieNode, index nibbleIndexT, oldKey, newKey []byte, newLeaf *leafNode) *branchNode {
-	var bn branchNode
+	old := n.twigs()
+	twigOffset := n.twigOffset(b)
+	twigs := p.get(len(old) + 1)
+	copyTwigs(twigs[:twigOffset], old[:twigOffset], n.cowMarked())
+	twigs[twigOffset] = *newLeaf
+	copyTwigs(twigs[twigOffset+1:], old[twigOffset:], n.cowMarked())
+	p.release(n)
+	n.setBranch(twigs, n.index(), n.bitmap()|b)
+	return &twigs[twigOffset]
+}
+
+func (n *gnode[V]) removeTwig(p *twigPool[V], b bitmapT) {
+	old := n.twigs()
+	twigOffset := n.twigOffset(b)
+	twigs := p.get(len(old) - 1)
+	copyTwigs(twigs[:twigOffset], old[:twigOffset], n.cowMarked())
+	copyTwigs(twigs[twigOffset:], old[twigOffset+1:], n.cowMarked())
+	p.release(n)
+	n.setBranch(twigs, n.index(), n.bitmap()&^b)
+}
+
+// newBranchNode replaces n with a branch at index holding the old n and
+// newLeaf, and returns where newLeaf was put.
+func (n *gnode[V]) newBranchNode(p *twigPool[V], index nibbleIndexT, oldKey, newKey []byte, newLeaf *gnode[V]) *gnode[V] {
 	b1 := nibbleBit(index, newKey)
 	b2 := nibbleBit(index, oldKey)
-	bn.twigs = make([]trieNode, 2)
-	bn.index = index
-	bn.bitmap = b1 | b2
-
+	twigs := p.get(2)
+	i := 0
 	if b1 < b2 {
-		bn.twigs[0] = newLeaf
-		bn.twigs[1] = n
+		twigs[0] = *newLeaf
+		twigs[1] = *n
 	} else {
-		bn.twigs[0] = n
-		bn.twigs[1] = newLeaf
+		twigs[0] = *n
+		twigs[1] = *newLeaf
+		i = 1
+	}
+	n.setBranch(twigs, index, b1|b2)
+	return &twigs[i]
+}
+
+// firstLeaf returns the leftmost leaf under n.
+func (n *gnode[V]) firstLeaf() *gnode[V] {
+	for n.isBranch() {
+		n = n.twig(0)
+	}
+	return n
+}
+
+// lastLeaf returns the rightmost leaf under n.
+func (n *gnode[V]) lastLeaf() *gnode[V] {
+	for n.isBranch() {
+		n = n.twig(n.twigOffsetMax() - 1)
 	}
-	return &bn
+	return n
 }
@@ -0,0 +1,135 @@
+package qp
+
+import (
+	"runtime"
+	"sync"
+)
+
+// BuildParallel builds a trie from pairs using up to workers goroutines
+// (GOMAXPROCS if workers <= 0). Pairs are partitioned by the upper nibble of
+// their first byte, each partition is built on its own and the partitions
+// become the twigs of the root branch. As with sequential Upserts, a later
+// pair for the same key updates an earlier one.
+//
+// Partitions are built concurrently, so handlers given by WithOnInsert and
+// WithOnUpdate are called from several goroutines at once and must be safe for
+// concurrent use.
+func BuildParallel(pairs []KVPair, workers int, opts ...Option) *Trie {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	var parts [16][]KVPair
+	for _, p := range pairs {
+		must(p.Key)
+		parts[p.Key[0]>>4] = append(parts[p.Key[0]>>4], p)
+	}
+
+	var subs [16]*Trie
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for i := range parts {
+		if len(parts[i]) == 0 {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			sub := New(opts...)
+			for _, p := range parts[i] {
+				sub.Upsert(p.Key, p.Value)
+			}
+			subs[i] = sub
+		}(i)
+	}
+	wg.Wait()
+
+	tr := New(opts...)
+	var bitmap bitmapT
+	var roots []node
+	for i, sub := range subs {
+		if sub == nil {
+			continue
+		}
+		// nibbleBit for upper nibble i
+		bitmap |= 1 << (i + 1)
+		roots = append(roots, sub.root)
+		tr.size += sub.size
+		if tr.arena != nil {
+			tr.arena.used += sub.arena.used
+			tr.arena.dead += sub.arena.dead
+		}
+	}
+	switch len(roots) {
+	case 0:
+	case 1:
+		tr.root = roots[0]
+	default:
+		twigs := tr.pool.get(len(roots))
+		copy(twigs, roots)
+		tr.root.setBranch(twigs, 0, bitmap)
+	}
+	return tr
+}
+
+// ParallelWalk calls fn for every key-value pair, fanning subtrees out to up to
+// workers goroutines (GOMAXPROCS if workers <= 0). fn is called concurrently
+// and in no particular order. The trie must not be modified until ParallelWalk returns.
+func (tr *Trie) ParallelWalk(workers int, fn func(key []byte, val any)) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if tr.root.isNil() {
+		return
+	}
+
+	// Split breadth first until there are a few subtrees per worker.
+	tasks := []*node{&tr.root}
+	for len(tasks) < 4*workers {
+		var next []*node
+		for _, n := range tasks {
+			if !n.isBranch() {
+				next = append(next, n)
+				continue
+			}
+			for i := 0; i < n.twigOffsetMax(); i++ {
+				next = append(next, n.twig(i))
+			}
+		}
+		if len(next) == len(tasks) {
+			break
+		}
+		tasks = next
+	}
+
+	ch := make(chan *node, len(tasks))
+	for _, n := range tasks {
+		ch <- n
+	}
+	close(ch)
+	var wg sync.WaitGroup
+	for i := 0; i < min(workers, len(tasks)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range ch {
+				walkNode(n, fn)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func walkNode(n *node, fn func(key []byte, val any)) {
+	if !n.isBranch() {
+		fn(n.key(), n.val)
+		return
+	}
+	twigs := n.twigs()
+	for i := range twigs {
+		walkNode(&twigs[i], fn)
+	}
+}
@@ -0,0 +1,97 @@
+package qp
+
+import (
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func Test_BuildParallel(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+	}{
+		{"empty", nil},
+		{"one partition", []string{"a", "ab", "b", "a"}},
+		{"partitions", []string{"a", "\x01", "\xff", "Z", "0", "a", "ab", "\x10"}},
+	}
+	onUpdate := WithOnUpdate(func(newVal, oldVal any) any { return newVal.(int) + oldVal.(int) })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pairs []KVPair
+			seq := New(onUpdate)
+			for i, k := range tt.keys {
+				pairs = append(pairs, KVPair{[]byte(k), i})
+				seq.Upsert([]byte(k), i)
+			}
+			tr := BuildParallel(pairs, 3, onUpdate)
+			if tr.Size() != seq.Size() {
+				t.Fatalf("Size got %d want %d", tr.Size(), seq.Size())
+			}
+			if got, want := tr.Walk(math.MaxInt, nil), seq.Walk(math.MaxInt, nil); !reflect.DeepEqual(got, want) {
+				t.Fatalf("Walk got %v want %v", got, want)
+			}
+			tr.Upsert([]byte("new"), 0)
+			tr.Delete([]byte("a"))
+		})
+	}
+
+	words := loadTestData(wordsPath)
+	pairs := make([]KVPair, len(words))
+	m := make(map[string]any, len(words))
+	for i, w := range words {
+		pairs[i] = KVPair{w, i}
+		m[string(w)] = i
+	}
+	checkTrie(t, BuildParallel(pairs, 0), m)
+}
+
+func Test_ParallelWalk(t *testing.T) {
+	words := loadTestData(wordsPath)
+	for _, n := range []int{0, 1, 3, 1000} {
+		tr := New()
+		for i, w := range words[:n] {
+			tr.Upsert(w, i)
+		}
+		var mu sync.Mutex
+		seen := make(map[string]int)
+		tr.ParallelWalk(4, func(key []byte, val any) {
+			mu.Lock()
+			seen[string(key)]++
+			mu.Unlock()
+			if v, _ := tr.Get(key); v != val {
+				t.Errorf("value mismatch for %q", key)
+			}
+		})
+		if len(seen) != tr.Size() {
+			t.Fatalf("visited %d keys want %d", len(seen), tr.Size())
+		}
+		for k, c := range seen {
+			if c != 1 {
+				t.Fatalf("%q visited %d times", k, c)
+			}
+		}
+	}
+}
+
+func Benchmark_Words_Build(b *testing.B) {
+	words := loadTestData(wordsPath)
+	pairs := make([]KVPair, len(words))
+	for i, w := range words {
+		pairs[i] = KVPair{w, nil}
+	}
+	b.Run("Upsert", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tr := New()
+			for _, p := range pairs {
+				tr.Upsert(p.Key, p.Value)
+			}
+		}
+	})
+	b.Run("BuildParallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			BuildParallel(pairs, 0)
+		}
+	})
+}
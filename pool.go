@@ -0,0 +1,55 @@
+package qp
+
+import "unsafe"
+
+const (
+	maxTwigs = 17
+	// arrays kept per size class beyond this are left to the GC
+	maxPooledTwigs = 4096
+)
+
+// twigPool keeps free lists of twig arrays, one per array length, so a trie
+// with steady churn reuses the arrays released by earlier mutations.
+// A nil pool allocates and releases nothing.
+type twigPool[V any] struct {
+	free [maxTwigs + 1][]*gnode[V]
+}
+
+func (p *twigPool[V]) get(n int) []gnode[V] {
+	if p != nil {
+		if l := p.free[n]; len(l) > 0 {
+			first := l[len(l)-1]
+			p.free[n] = l[:len(l)-1]
+			return unsafe.Slice(first, n)
+		}
+	}
+	return make([]gnode[V], n)
+}
+
+// put releases twigs, which must not be referenced by any trie.
+func (p *twigPool[V]) put(twigs []gnode[V]) {
+	if p == nil || len(p.free[len(twigs)]) >= maxPooledTwigs {
+		return
+	}
+	clear(twigs)
+	p.free[len(twigs)] = append(p.free[len(twigs)], &twigs[0])
+}
+
+// release puts the twig array of n back if n owns it.
+func (p *twigPool[V]) release(n *gnode[V]) {
+	if p != nil && n.isBranch() && !n.cowMarked() {
+		p.put(n.twigs())
+	}
+}
+
+// recycle releases every twig array reachable from n that is not shared.
+func (p *twigPool[V]) recycle(n *gnode[V]) {
+	if !n.isBranch() || n.cowMarked() {
+		return
+	}
+	twigs := n.twigs()
+	for i := range twigs {
+		p.recycle(&twigs[i])
+	}
+	p.put(twigs)
+}
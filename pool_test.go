@@ -0,0 +1,116 @@
+package qp
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func Test_NodePoolSteadyState(t *testing.T) {
+	words := loadTestData(wordsPath)[:50000]
+	tr := New(WithNodePool())
+	for _, w := range words {
+		tr.Upsert(w, nil)
+	}
+
+	rd := rand.New(rand.NewSource(1))
+	churn := func() {
+		w := words[rd.Intn(len(words))]
+		tr.Delete(w)
+		tr.Upsert(w, nil)
+	}
+	for i := 0; i < 10000; i++ {
+		churn()
+	}
+	if allocs := testing.AllocsPerRun(10000, churn); allocs > 0.01 {
+		t.Fatalf("allocs per op = %v, want ~0", allocs)
+	}
+	if tr.Size() != len(words) {
+		t.Fatalf("Size got %d want %d", tr.Size(), len(words))
+	}
+}
+
+func Test_NodePoolAbort(t *testing.T) {
+	words := loadTestData(wordsPath)[:20000]
+	tr := New(WithNodePool())
+	m := make(map[string]any)
+	for _, w := range words[:10000] {
+		tr.Upsert(w, value1)
+		m[string(w)] = value1
+	}
+
+	rd := rand.New(rand.NewSource(1))
+	txn := func() {
+		tx := tr.Txn()
+		for i := 0; i < 50; i++ {
+			w := words[rd.Intn(len(words))]
+			if rd.Intn(2) == 0 {
+				tx.Delete(w)
+			} else {
+				tx.Upsert(w, value2)
+			}
+		}
+		tx.Abort()
+	}
+	for i := 0; i < 100; i++ {
+		txn()
+	}
+	checkTrie(t, tr, m)
+	if allocs := testing.AllocsPerRun(100, txn); allocs > 10 {
+		t.Fatalf("allocs per aborted txn = %v, want only the Txn itself", allocs)
+	}
+	checkTrie(t, tr, m)
+}
+
+func Test_NodePoolCow(t *testing.T) {
+	words := loadTestData(wordsPath)[:20000]
+	rd := rand.New(rand.NewSource(2))
+	tr := New(WithNodePool())
+	oldM := make(map[string]any)
+	for _, w := range words[:10000] {
+		tr.Upsert(w, value1)
+		oldM[string(w)] = value1
+	}
+	newM := make(map[string]any, len(oldM))
+	for k, v := range oldM {
+		newM[k] = v
+	}
+
+	tx := tr.Txn()
+	for i := 0; i < 20000; i++ {
+		w := words[rd.Intn(len(words))]
+		if rd.Intn(2) == 0 {
+			tx.Delete(w)
+			delete(newM, string(w))
+		} else {
+			tx.Upsert(w, i)
+			newM[string(w)] = i
+		}
+	}
+	checkTrie(t, tx.oldTr, oldM)
+	checkTrie(t, tx.Commit(), newM)
+}
+
+func Benchmark_Words_Churn(b *testing.B) {
+	words := loadTestData(wordsPath)
+	for _, pooled := range []bool{false, true} {
+		name := "default"
+		var opts []Option
+		if pooled {
+			name = "pooled"
+			opts = append(opts, WithNodePool())
+		}
+		b.Run(name, func(b *testing.B) {
+			tr := New(opts...)
+			for _, w := range words {
+				tr.Upsert(w, nil)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := words[i%len(words)]
+				tr.Delete(w)
+				tr.Upsert(w, nil)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"math"
+	"sync/atomic"
 )
 
 type bitmapT = uint32      // bitmap type, 17 bits, first bit NO_BYTE
@@ -49,13 +50,41 @@ func WithOnUpdate(f OnUpdateValFn) Option {
 	}
 }
 
+// WithKeyArena makes the trie copy inserted keys into an internal arena instead
+// of keeping the caller's slices, so callers may reuse their key buffers.
+// The arena is compacted once most of it belongs to deleted keys.
+func WithKeyArena() Option {
+	return func(tr *Trie) {
+		tr.arena = &keyArena{}
+	}
+}
+
 type Trie struct {
-	root     trieNode
-	size     int
+	trie[any]
 	onInsert OnInsertValFn
 	onUpdate OnUpdateValFn
 }
 
+// trie holds the nodes of a Trie or a Set, with the operations that do not
+// depend on what the leaves hold.
+type trie[V any] struct {
+	root   gnode[V]
+	size   int
+	arena  *keyArena    // nil unless WithKeyArena
+	pool   *twigPool[V] // nil unless WithNodePool
+	shared atomic.Bool  // set by share, see own
+}
+
+// WithNodePool makes the trie keep free lists of the twig arrays released by
+// Upsert, Delete and Txn.Abort and reuse them, so a workload that keeps
+// inserting and deleting keys runs without allocating once warmed up.
+// Arrays still shared with another trie are never reused.
+func WithNodePool() Option {
+	return func(tr *Trie) {
+		tr.pool = &twigPool[any]{}
+	}
+}
+
 // New creates and initializes a new Trie with the given options.
 // If no onInsert or onUpdate handlers are provided, default handlers will be used.
 // default onInsert: func(newVal any) any { return newVal }
@@ -65,13 +94,18 @@ func New(opts ...Option) *Trie {
 	for _, opt := range opts {
 		opt(&tr)
 	}
+	tr.initHandlers()
+	return &tr
+}
+
+// initHandlers installs the default handlers, so a zero Trie can be filled by decoding.
+func (tr *Trie) initHandlers() {
 	if tr.onInsert == nil {
 		tr.onInsert = defaultOnInsert
 	}
 	if tr.onUpdate == nil {
 		tr.onUpdate = defaultOnUpdate
 	}
-	return &tr
 }
 
 // Size returns the total number of key-value pairs stored in the trie.
@@ -79,76 +113,72 @@ func (tr *Trie) Size() int {
 	return tr.size
 }
 
-func (tr *Trie) findMatch(key []byte, exactMatch bool) *leafNode {
-	if tr.root == nil {
+func (tr *trie[V]) findMatch(key []byte, exactMatch bool) *gnode[V] {
+	if tr.root.isNil() {
 		return nil
 	}
-	var bn *branchNode
-	ptr := &tr.root
-	for {
-		switch n := (*ptr).(type) {
-		case *leafNode:
-			return n
-		case *branchNode:
-			bn = n
-			i := 0
-			b := bn.twigBit(key)
-			if bn.hasTwig(b) {
-				i = bn.twigOffset(b)
-			} else {
-				if exactMatch {
-					return nil
-				}
-			}
-			ptr = bn.twig(i)
+	n := &tr.root
+	for n.isBranch() {
+		i := 0
+		b := n.twigBit(key)
+		if n.hasTwig(b) {
+			i = n.twigOffset(b)
+		} else if exactMatch {
+			return nil
 		}
+		n = n.twig(i)
 	}
+	return n
 }
 
-func (tr *Trie) findInsert(key []byte, index nibbleIndexT) (ptr *trieNode, grow bool) {
+// findInsert descends to where a key that first differs from its closest leaf
+// at index goes, unsharing the branches it passes through and counting the new
+// key in them. grow reports that the key becomes a new twig of the branch at
+// ptr rather than splitting ptr. With exactMatch it descends to the leaf
+// holding key instead, and counts nothing.
+func (tr *trie[V]) findInsert(key []byte, index nibbleIndexT, exactMatch bool) (ptr *gnode[V], grow bool) {
+	tr.own()
 	ptr = &tr.root
-	for {
-		switch n := (*ptr).(type) {
-		case *leafNode:
-			return ptr, false
-		case *branchNode:
-			if index == n.index {
+	for ptr.isBranch() {
+		if !exactMatch {
+			if index == ptr.index() {
 				return ptr, true
 			}
-			if index < n.index {
+			if index < ptr.index() {
 				return ptr, false
 			}
+		}
 
-			b := n.twigBit(key)
-			if !n.hasTwig(b) {
-				panic(errInternal)
-			}
-			i := n.twigOffset(b)
-			ptr = n.twig(i)
+		b := ptr.twigBit(key)
+		if !ptr.hasTwig(b) {
+			panic(errInternal)
 		}
+		ptr.unshare(tr.pool)
+		if !exactMatch {
+			ptr.addCount(1)
+		}
+		ptr = ptr.twig(ptr.twigOffset(b))
 	}
+	return ptr, false
 }
 
-func (tr *Trie) findDelete(key []byte) (parentBranch *trieNode, leaf *leafNode, b bitmapT) {
-	if tr.root == nil {
-		return nil, nil, 0
-	}
-
+// findDelete descends to the leaf holding key, which must exist, unsharing
+// every branch on the way except the leaf's parent, which the caller replaces,
+// and uncounting the key in them.
+func (tr *trie[V]) findDelete(key []byte) (parentBranch *gnode[V], leaf *gnode[V], b bitmapT) {
+	tr.own()
 	ptr := &tr.root
-	for {
-		switch n := (*ptr).(type) {
-		case *leafNode:
-			return parentBranch, n, b
-		case *branchNode:
-			b = n.twigBit(key)
-			if !n.hasTwig(b) {
-				return nil, nil, 0
-			}
-			i := n.twigOffset(b)
-			parentBranch = ptr
-			ptr = n.twig(i)
+	for ptr.isBranch() {
+		b = ptr.twigBit(key)
+		i := ptr.twigOffset(b)
+		if ptr.twig(i).isBranch() {
+			ptr.unshare(tr.pool)
 		}
+		ptr.addCount(-1)
+		parentBranch = ptr
+		ptr = ptr.twig(i)
 	}
+	return parentBranch, ptr, b
 }
 
 // Get retrieves the value associated with the given key from the trie.
@@ -156,45 +186,111 @@ func (tr *Trie) findDelete(key []byte) (parentBranch *trieNode, leaf *leafNode,
 // If the key is not present in the trie, it returns nil and false.
 func (tr *Trie) Get(key []byte) (val any, found bool) {
 	must(key)
-	leaf := tr.findMatch(key, true)
-	if leaf != nil && bytes.Equal(key, leaf.key) {
-		return leaf.value, true
+	if leaf := tr.lookup(key); leaf != nil {
+		return leaf.val, true
 	}
 	return nil, false
 }
 
+// lookup returns the leaf holding key, or nil.
+func (tr *trie[V]) lookup(key []byte) *gnode[V] {
+	leaf := tr.findMatch(key, true)
+	if leaf != nil && bytes.Equal(key, leaf.key()) {
+		return leaf
+	}
+	return nil
+}
+
+// GetMany looks up every key and stores the results in out[i] and found[i],
+// which must be at least as long as keys. Consecutive keys that share a prefix
+// resume the descent from the deepest branch their paths have in common, so
+// sorted keys are looked up much faster than with Get. Any order is correct.
+func (tr *Trie) GetMany(keys [][]byte, out []any, found []bool) {
+	_, _ = out[:len(keys)], found[:len(keys)]
+	if tr.root.isNil() {
+		clear(out[:len(keys)])
+		clear(found[:len(keys)])
+		return
+	}
+
+	var buf [64]*node
+	path := buf[:0] // branches on the path of the previous key
+	var prev []byte
+	for i, key := range keys {
+		must(key)
+		if prev != nil {
+			index, _ := nibbleIndex(prev, key)
+			for len(path) > 0 && path[len(path)-1].index() >= index {
+				path = path[:len(path)-1]
+			}
+		}
+		prev = key
+
+		n := &tr.root
+		if len(path) > 0 {
+			bn := path[len(path)-1]
+			n = bn.twig(bn.twigOffset(bn.twigBit(key)))
+		}
+		for n.isBranch() {
+			b := n.twigBit(key)
+			if !n.hasTwig(b) {
+				break
+			}
+			path = append(path, n)
+			n = n.twig(n.twigOffset(b))
+		}
+		if !n.isBranch() && bytes.Equal(key, n.key()) {
+			out[i], found[i] = n.val, true
+		} else {
+			out[i], found[i] = nil, false
+		}
+	}
+}
+
 // Upsert inserts or updates a key-value pair in the trie.
 // If the key already exists, it updates the value and returns the old value with isUpdate=true.
 // If the key does not exist, it inserts the new key-value pair and returns nil with isUpdate=false.
+// Unless the trie was created WithKeyArena, it keeps a reference to key, which must not be modified afterwards.
 func (tr *Trie) Upsert(key []byte, value any) (oldVal any, isUpdate bool) {
 	must(key)
+	leaf, added := tr.insert(key)
+	if added {
+		leaf.val = tr.onInsert(value)
+		return nil, false
+	}
+	preValue := leaf.val
+	leaf.val = tr.onUpdate(value, preValue)
+	return preValue, true
+}
 
-	if tr.root == nil {
-		tr.root = &leafNode{key: key, value: tr.onInsert(value)}
+// insert returns the leaf holding key, adding one with the zero value if there
+// is none, and reports whether it was added.
+func (tr *trie[V]) insert(key []byte) (leaf *gnode[V], added bool) {
+	var zero V
+	if tr.root.isNil() {
+		tr.root.setLeaf(tr.ownKey(key), zero)
 		tr.size++
-		return nil, false
+		return &tr.root, true
 	}
 
-	leaf := tr.findMatch(key, false)
-	index, match := nibbleIndex(key, leaf.key)
+	leaf = tr.findMatch(key, false)
+	index, match := nibbleIndex(key, leaf.key())
 	if match {
-		preValue := leaf.value
-		leaf.value = tr.onUpdate(value, preValue)
-		return preValue, true
+		leaf, _ = tr.findInsert(key, index, true)
+		return leaf, false
 	}
 
-	newLeaf := &leafNode{key: key, value: tr.onInsert(value)}
-	ptr, grow := tr.findInsert(key, index)
+	var newLeaf gnode[V]
+	newLeaf.setLeaf(tr.ownKey(key), zero)
+	ptr, grow := tr.findInsert(key, index, false)
 	if grow {
-		bn := (*ptr).(*branchNode)
-		bn.growTwigs(index, key, newLeaf)
+		leaf = ptr.growTwigs(tr.pool, index, key, &newLeaf)
 	} else {
-		bn := newBranchNode(*ptr, index, leaf.key, key, newLeaf)
-		*ptr = bn
+		leaf = ptr.newBranchNode(tr.pool, index, leaf.key(), key, &newLeaf)
 	}
 
 	tr.size++
-	return nil, false
+	return leaf, true
 }
 
 // Delete removes the entry for the given key from the trie.
@@ -203,72 +299,78 @@ func (tr *Trie) Upsert(key []byte, value any) (oldVal any, isUpdate bool) {
 // If the key is not found, it returns nil and false.
 func (tr *Trie) Delete(key []byte) (oldVal any, found bool) {
 	must(key)
+	return tr.delete(key)
+}
 
-	parentBn, leaf, b := tr.findDelete(key)
-	if leaf == nil || !bytes.Equal(key, leaf.key) {
-		return nil, false
+// delete removes key and returns the value of its leaf.
+func (tr *trie[V]) delete(key []byte) (oldVal V, found bool) {
+	leaf := tr.lookup(key)
+	if leaf == nil {
+		return oldVal, false
 	}
 	tr.size--
-	if parentBn == nil {
-		// only when root is leafNode
-		tr.root = nil
-		return leaf.value, true
+	oldVal = leaf.val
+	if tr.arena != nil {
+		tr.arena.free(key)
+		defer tr.maybeCompactKeys()
+	}
+
+	parent, _, b := tr.findDelete(key)
+	if parent == nil {
+		// only when root is leaf
+		tr.root = gnode[V]{}
+		return oldVal, true
 	}
 
-	bn := (*parentBn).(*branchNode)
-	if bn.twigOffsetMax() == 2 {
+	if parent.twigOffsetMax() == 2 {
 		other := 0
-		if bn.twigOffset(b) == 0 {
+		if parent.twigOffset(b) == 0 {
 			other = 1
 		}
 		// Move the other twig to the parent branch.
-		otherTwig := bn.twig(other)
-		*parentBn = *otherTwig
-		return leaf.value, true
+		otherTwig := *parent.twig(other)
+		if parent.cowMarked() {
+			otherTwig.markCow()
+		}
+		tr.pool.release(parent)
+		*parent = otherTwig
+		return oldVal, true
 	}
 
-	bn.removeTwig(b)
-	return leaf.value, true
+	parent.removeTwig(tr.pool, b)
+	return oldVal, true
+}
+
+// ownKey returns the key to store in a new leaf.
+func (tr *trie[V]) ownKey(key []byte) []byte {
+	if tr.arena == nil {
+		return key
+	}
+	return tr.arena.alloc(key)
 }
 
-func (tr *Trie) findPrev(index nibbleIndexT, key []byte) (prev *trieNode, cur *trieNode, needCheckCur bool) {
+func (tr *trie[V]) maybeCompactKeys() {
+	if tr.arena.needCompact() {
+		tr.compactKeys()
+	}
+}
+
+func (tr *Trie) findPrev(index nibbleIndexT, key []byte) (prev *node, cur *node, needCheckCur bool) {
 	cur = &tr.root
 	for {
-		switch n := (*cur).(type) {
-		case *leafNode:
+		if !cur.isBranch() || index < cur.index() {
 			needCheckCur = true
 			return
-		case *branchNode:
-			bn := (*cur).(*branchNode)
-			if index < bn.index {
-				needCheckCur = true
-				return
-			}
-			b := bn.twigBit(key)
-			i := bn.twigOffset(b)
-			if i > 0 {
-				prev = bn.twig(i - 1)
-			}
-			if index == bn.index {
-				return
-			}
-			cur = n.twig(i)
 		}
-	}
-}
-
-func (tr *Trie) lastLeaf(node *trieNode) *leafNode {
-	ptr := node
-	for {
-		switch n := (*ptr).(type) {
-		case *leafNode:
-			leaf := (*ptr).(*leafNode)
-			return leaf
-		case *branchNode:
-			bn := (*ptr).(*branchNode)
-			offsetMax := bn.twigOffsetMax()
-			ptr = n.twig(offsetMax - 1)
+		b := cur.twigBit(key)
+		i := cur.twigOffset(b)
+		if i > 0 {
+			prev = cur.twig(i - 1)
+		}
+		if index == cur.index() {
+			return
 		}
+		cur = cur.twig(i)
 	}
 }
 
@@ -278,16 +380,16 @@ func (tr *Trie) lastLeaf(node *trieNode) *leafNode {
 func (tr *Trie) GetLessOrEqual(key []byte) (k []byte, v any, exactMatch bool) {
 	must(key)
 
-	if tr.root == nil {
+	if tr.root.isNil() {
 		return nil, nil, false
 	}
 
 	leaf := tr.findMatch(key, false)
-	if leaf != nil && bytes.Equal(key, leaf.key) {
-		return key, leaf.value, true
+	if bytes.Equal(key, leaf.key()) {
+		return leaf.key(), leaf.val, true
 	}
 
-	index, match := nibbleIndex(key, leaf.key)
+	index, match := nibbleIndex(key, leaf.key())
 	if match {
 		panic(errInternal)
 	}
@@ -295,25 +397,88 @@ func (tr *Trie) GetLessOrEqual(key []byte) (k []byte, v any, exactMatch bool) {
 	prev, cur, needCheckCur := tr.findPrev(index, key)
 	if needCheckCur {
 		b1 := nibbleBit(index, key)
-		b2 := nibbleBit(index, leaf.key)
+		b2 := nibbleBit(index, leaf.key())
 		if b1 > b2 {
-			leaf = tr.lastLeaf(cur)
-			return leaf.key, leaf.value, false
+			leaf = cur.lastLeaf()
+			return leaf.key(), leaf.val, false
 		}
 	}
 
 	if prev == nil {
 		return nil, nil, false
 	}
-	leaf = tr.lastLeaf(prev)
-	return leaf.key, leaf.value, false
+	leaf = prev.lastLeaf()
+	return leaf.key(), leaf.val, false
 }
 
-func must(key []byte) {
+// LongestPrefix returns the longest key in the trie that is a prefix of key,
+// including key itself. It returns nil, nil, false if there is none.
+func (tr *Trie) LongestPrefix(key []byte) (k []byte, v any, found bool) {
+	must(key)
+	if tr.root.isNil() {
+		return nil, nil, false
+	}
+
+	var best *node
+	n := &tr.root
+	for n.isBranch() {
+		// A key that ends right before the index is the NO_BYTE twig, and is
+		// a prefix of every longer candidate under n.
+		if n.hasTwig(1) {
+			if leaf := n.twig(0); bytes.HasPrefix(key, leaf.key()) {
+				best = leaf
+			}
+		}
+		b := n.twigBit(key)
+		if !n.hasTwig(b) {
+			break
+		}
+		n = n.twig(n.twigOffset(b))
+	}
+	if !n.isBranch() && bytes.HasPrefix(key, n.key()) {
+		best = n
+	}
+	if best == nil {
+		return nil, nil, false
+	}
+	return best.key(), best.val, true
+}
+
+// findPrefix returns the root of the smallest subtree holding every key that
+// starts with prefix, or nil if there is none. An empty prefix matches all keys.
+func (tr *Trie) findPrefix(prefix []byte) *node {
+	if tr.root.isNil() {
+		return nil
+	}
+	n := &tr.root
+	for n.isBranch() && int(n.index()) < 2*len(prefix) {
+		b := n.twigBit(prefix)
+		if !n.hasTwig(b) {
+			return nil
+		}
+		n = n.twig(n.twigOffset(b))
+	}
+	// The keys under n agree on the first len(prefix) bytes.
+	if !bytes.HasPrefix(n.firstLeaf().key(), prefix) {
+		return nil
+	}
+	return n
+}
+
+// CheckKey returns an error if key is empty or too long to be stored.
+// Methods taking a key panic with this error instead.
+func CheckKey(key []byte) error {
 	if len(key) == 0 {
-		panic(errKeyEmpty)
+		return errKeyEmpty
 	}
 	if len(key) > maxKeyBytes {
-		panic(errKeyTooLong)
+		return errKeyTooLong
+	}
+	return nil
+}
+
+func must(key []byte) {
+	if err := CheckKey(key); err != nil {
+		panic(err)
 	}
 }
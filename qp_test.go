@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"runtime"
 	"testing"
 	"time"
 )
@@ -368,6 +369,25 @@ func Benchmark_UUID_Get(b *testing.B) {
 	}
 }
 
+// Benchmark_Words_Memory reports the live heap held by the trie per key,
+// excluding the keys and values themselves.
+func Benchmark_Words_Memory(b *testing.B) {
+	words := loadTestData(wordsPath)
+	var before, after runtime.MemStats
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		tr := New()
+		for _, w := range words {
+			tr.Upsert(w, nil)
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/float64(tr.Size()), "B/key")
+		runtime.KeepAlive(tr)
+	}
+}
+
 const (
 	value1 = 1
 	value2 = 2
@@ -418,3 +438,96 @@ func randString() string {
 	}
 	return string(b)
 }
+
+func Test_GetMany(t *testing.T) {
+	sortedWords := loadTestData(wordsSortedPath)
+	tr := New()
+	for i, w := range sortedWords {
+		if i%3 != 0 {
+			tr.Upsert(w, i)
+		}
+	}
+
+	check := func(keys [][]byte) {
+		t.Helper()
+		out := make([]any, len(keys))
+		found := make([]bool, len(keys))
+		for i := range out {
+			out[i], found[i] = "stale", true
+		}
+		tr.GetMany(keys, out, found)
+		for i, k := range keys {
+			v, ok := tr.Get(k)
+			if found[i] != ok || out[i] != v {
+				t.Fatalf("GetMany(%q) got %v, %v want %v, %v", k, out[i], found[i], v, ok)
+			}
+		}
+	}
+
+	check(sortedWords)
+	check([][]byte{[]byte("zzz"), []byte("a"), []byte("aardvark"), []byte("a\x00"), []byte("Z")})
+	check(nil)
+
+	var empty Trie
+	out, found := []any{1}, []bool{true}
+	empty.GetMany([][]byte{[]byte("a")}, out, found)
+	if out[0] != nil || found[0] {
+		t.Fatalf("GetMany on empty trie got %v, %v", out[0], found[0])
+	}
+}
+
+func Benchmark_Words_GetMany(b *testing.B) {
+	words := loadTestData(wordsSortedPath)
+	tr := New()
+	for _, w := range words {
+		tr.Upsert(w, w)
+	}
+	out := make([]any, len(words))
+	found := make([]bool, len(words))
+
+	b.Run("Get", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j, w := range words {
+				out[j], found[j] = tr.Get(w)
+			}
+		}
+	})
+	b.Run("GetMany", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tr.GetMany(words, out, found)
+		}
+	})
+}
+
+func Test_LongestPrefix(t *testing.T) {
+	data := []string{"a", "abc", "abcd\x00", "abd", "b", "ba", "bab", "c\x00"}
+	tr := New()
+	for _, d := range data {
+		tr.Upsert([]byte(d), d)
+	}
+	tests := []struct {
+		search, expect string
+	}{
+		{"a", "a"},
+		{"ab", "a"},
+		{"abc", "abc"},
+		{"abcd", "abc"},
+		{"abcd\x00\x01", "abcd\x00"},
+		{"abda", "abd"},
+		{"b\xff", "b"},
+		{"baba", "bab"},
+		{"c", ""},
+		{"c\x00\x00", "c\x00"},
+		{"d", ""},
+		{"\x00", ""},
+	}
+	for _, tt := range tests {
+		k, v, found := tr.LongestPrefix([]byte(tt.search))
+		if string(k) != tt.expect || found != (tt.expect != "") || (found && v != tt.expect) {
+			t.Errorf("LongestPrefix(%q) got %q, %v, %v want %q", tt.search, k, v, found, tt.expect)
+		}
+	}
+	if _, _, found := New().LongestPrefix([]byte("a")); found {
+		t.Errorf("LongestPrefix on empty trie should not find anything")
+	}
+}
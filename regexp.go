@@ -0,0 +1,220 @@
+package qp
+
+import (
+	"encoding/binary"
+	"errors"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+var errRegexpAssertion = errors.New("qp: multi-line anchors and word boundaries are not supported")
+
+// CompileRegexp compiles a regular expression in Go syntax to an Automaton
+// that accepts the keys the expression matches in full, as if written
+// ^(?:expr)$. Keys are read as UTF-8 the way package regexp reads them, an
+// invalid byte matching U+FFFD.
+//
+// The automaton is built lazily while it is stepped, so it is not safe for
+// concurrent use.
+func CompileRegexp(expr string) (Automaton, error) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	prog, err := syntax.Compile(re.Simplify())
+	if err != nil {
+		return nil, err
+	}
+	for _, inst := range prog.Inst {
+		if inst.Op == syntax.InstEmptyWidth &&
+			syntax.EmptyOp(inst.Arg)&^(syntax.EmptyBeginText|syntax.EmptyEndText) != 0 {
+			return nil, errRegexpAssertion
+		}
+	}
+	a := &regexpAutomaton{prog: prog, seen: make([]uint32, len(prog.Inst))}
+	a.dfa.init(nil)
+	a.intern(nil) // state 0 is dead
+	var start []nfaThread
+	a.add(&start, uint32(prog.Start), true, false)
+	a.start = a.intern(start)
+	return a, nil
+}
+
+// nfaThread is a position in the program, with the bytes of a rune read so far.
+type nfaThread struct {
+	pc      uint32
+	pending string
+}
+
+type regexpState struct {
+	threads []nfaThread
+	match   bool
+}
+
+// regexpAutomaton determinizes a regexp program one state at a time.
+// A state is the set of threads alive after the bytes read.
+type regexpAutomaton struct {
+	prog   *syntax.Prog
+	start  int
+	dfa    dfaCache
+	states []regexpState
+	seen   []uint32 // generation an instruction was last added in
+	gen    uint32
+}
+
+func (a *regexpAutomaton) Start() int {
+	return a.start
+}
+
+func (a *regexpAutomaton) Step(state int, b byte) int {
+	if next, ok := a.dfa.cached(state, b); ok {
+		return next
+	}
+	next := a.intern(a.step(a.states[state].threads, b))
+	a.dfa.set(state, b, next)
+	return next
+}
+
+func (a *regexpAutomaton) IsMatch(state int) bool {
+	return a.states[state].match
+}
+
+func (a *regexpAutomaton) CanMatch(state int) bool {
+	return state != 0
+}
+
+// intern returns the state for threads, creating it if needed.
+func (a *regexpAutomaton) intern(threads []nfaThread) int {
+	slices.SortFunc(threads, func(x, y nfaThread) int {
+		if x.pc != y.pc {
+			return int(x.pc) - int(y.pc)
+		}
+		return strings.Compare(x.pending, y.pending)
+	})
+	threads = slices.Compact(threads)
+	var sb strings.Builder
+	for _, t := range threads {
+		sb.Write(binary.LittleEndian.AppendUint32(nil, t.pc))
+		sb.WriteByte(byte(len(t.pending)))
+		sb.WriteString(t.pending)
+	}
+	id, added := a.dfa.intern(sb.String())
+	if added {
+		a.states = append(a.states, regexpState{threads: threads, match: a.matchAtEnd(threads)})
+	}
+	return id
+}
+
+// add adds the threads reached from pc without reading input. Text start
+// assertions hold only at the start. Text end assertions hold only at the end,
+// and are otherwise kept as threads until the end is known.
+func (a *regexpAutomaton) add(threads *[]nfaThread, pc uint32, atStart, atEnd bool) {
+	a.gen++
+	a.addFrom(threads, pc, atStart, atEnd)
+}
+
+func (a *regexpAutomaton) addFrom(threads *[]nfaThread, pc uint32, atStart, atEnd bool) {
+	if a.seen[pc] == a.gen {
+		return
+	}
+	a.seen[pc] = a.gen
+	inst := &a.prog.Inst[pc]
+	switch inst.Op {
+	case syntax.InstAlt, syntax.InstAltMatch:
+		a.addFrom(threads, inst.Out, atStart, atEnd)
+		a.addFrom(threads, inst.Arg, atStart, atEnd)
+	case syntax.InstNop, syntax.InstCapture:
+		a.addFrom(threads, inst.Out, atStart, atEnd)
+	case syntax.InstEmptyWidth:
+		op := syntax.EmptyOp(inst.Arg)
+		switch {
+		case op&syntax.EmptyBeginText != 0 && !atStart:
+		case op&syntax.EmptyEndText != 0 && !atEnd:
+			*threads = append(*threads, nfaThread{pc: pc})
+		default:
+			a.addFrom(threads, inst.Out, atStart, atEnd)
+		}
+	case syntax.InstFail:
+	default:
+		*threads = append(*threads, nfaThread{pc: pc})
+	}
+}
+
+// step returns the threads after reading b.
+func (a *regexpAutomaton) step(threads []nfaThread, b byte) []nfaThread {
+	var next []nfaThread
+	for _, t := range threads {
+		inst := &a.prog.Inst[t.pc]
+		if inst.Op != syntax.InstRune && inst.Op != syntax.InstRune1 &&
+			inst.Op != syntax.InstRuneAny && inst.Op != syntax.InstRuneAnyNotNL {
+			continue // a match or an end assertion, which input ends
+		}
+		p := t.pending + string([]byte{b})
+		if !utf8.FullRuneInString(p) {
+			next = append(next, nfaThread{pc: t.pc, pending: p})
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(p)
+		next = append(next, a.feed(inst, r, p[size:])...)
+	}
+	return next
+}
+
+// feed returns the threads after inst matched r, followed by the bytes rest
+// that were read but not part of r.
+func (a *regexpAutomaton) feed(inst *syntax.Inst, r rune, rest string) []nfaThread {
+	if !matchRune(inst, r) {
+		return nil
+	}
+	var threads []nfaThread
+	a.add(&threads, inst.Out, false, false)
+	for i := 0; i < len(rest); i++ {
+		threads = a.step(threads, rest[i])
+	}
+	return threads
+}
+
+func matchRune(inst *syntax.Inst, r rune) bool {
+	switch inst.Op {
+	case syntax.InstRuneAny:
+		return true
+	case syntax.InstRuneAnyNotNL:
+		return r != '\n'
+	}
+	return inst.MatchRune(r)
+}
+
+// matchAtEnd reports whether input ending with threads alive is matched.
+// A rune cut short by the end is read as U+FFFD per byte.
+func (a *regexpAutomaton) matchAtEnd(threads []nfaThread) bool {
+	for _, t := range threads {
+		inst := &a.prog.Inst[t.pc]
+		switch {
+		case inst.Op == syntax.InstMatch:
+			return true
+		case inst.Op == syntax.InstEmptyWidth:
+			if a.reachesMatch(t.pc) {
+				return true
+			}
+		case t.pending != "":
+			if a.matchAtEnd(a.feed(inst, utf8.RuneError, t.pending[1:])) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reachesMatch reports whether pc reaches a match at the end of input.
+func (a *regexpAutomaton) reachesMatch(pc uint32) bool {
+	var threads []nfaThread
+	a.add(&threads, pc, false, true)
+	for _, t := range threads {
+		if a.prog.Inst[t.pc].Op == syntax.InstMatch {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package qp
+
+// Set is a set of keys. Its leaves hold a key and no value, so a key takes
+// two words less than in a Trie.
+//
+// Union, Intersect and Difference return new sets that share unchanged
+// subtrees with their operands copy-on-write, so they cost time and memory
+// in proportion to where the operands overlap rather than to their sizes.
+type Set struct {
+	tr trie[struct{}]
+}
+
+// NewSet creates an empty set. WithKeyArena and WithNodePool apply as they do
+// to a Trie; value handlers have no effect.
+func NewSet(opts ...Option) *Set {
+	var o Trie
+	for _, opt := range opts {
+		opt(&o)
+	}
+	s := &Set{}
+	s.tr.arena = o.arena
+	if o.pool != nil {
+		s.tr.pool = &twigPool[struct{}]{}
+	}
+	return s
+}
+
+// derive returns an empty set with the options of s.
+func (s *Set) derive() *Set {
+	res := &Set{}
+	res.tr.inherit(&s.tr)
+	return res
+}
+
+// Size returns the number of keys in the set.
+func (s *Set) Size() int {
+	return s.tr.size
+}
+
+// Add adds key to the set and reports whether it was not already present.
+// The key must not be nil.
+func (s *Set) Add(key []byte) (added bool) {
+	must(key)
+	_, added = s.tr.insert(key)
+	return added
+}
+
+// Has reports whether key is in the set.
+func (s *Set) Has(key []byte) bool {
+	must(key)
+	return s.tr.lookup(key) != nil
+}
+
+// Remove removes key from the set and reports whether it was present.
+func (s *Set) Remove(key []byte) (removed bool) {
+	must(key)
+	_, removed = s.tr.delete(key)
+	return removed
+}
+
+// Union returns the keys in s or o.
+func (s *Set) Union(o *Set) *Set {
+	res := s.derive()
+	res.tr.unionOf(&s.tr, &o.tr, nil)
+	return res
+}
+
+// Intersect returns the keys in both s and o.
+func (s *Set) Intersect(o *Set) *Set {
+	res := s.derive()
+	res.tr.intersectOf(&s.tr, &o.tr)
+	return res
+}
+
+// Difference returns the keys in s that are not in o.
+func (s *Set) Difference(o *Set) *Set {
+	res := s.derive()
+	res.tr.differenceOf(&s.tr, &o.tr)
+	return res
+}
+
+// IsSubset reports whether every key in s is also in o.
+func (s *Set) IsSubset(o *Set) bool {
+	return s.tr.subset(&o.tr)
+}
+
+// Iterator returns an iterator over the keys in lexicographical order.
+func (s *Set) Iterator() *SetIterator {
+	var it SetIterator
+	it.it.reset(&s.tr)
+	return &it
+}
+
+// SetIterator walks the keys of a Set in lexicographical order.
+type SetIterator struct {
+	it iter[struct{}]
+}
+
+// Seek positions the iterator at the first key that is greater than or equal to key.
+func (it *SetIterator) Seek(key []byte) {
+	must(key)
+	it.it.seek(key)
+}
+
+// Next returns the next key, or ok=false at the end.
+// The returned key should not be modified by the caller.
+func (it *SetIterator) Next() (key []byte, ok bool) {
+	leaf := it.it.leaf
+	if leaf == nil {
+		return nil, false
+	}
+	it.it.advance()
+	return leaf.key(), true
+}
@@ -0,0 +1,186 @@
+package qp
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"unsafe"
+)
+
+func randSet(r *rand.Rand, n int, opts ...Option) (*Set, map[string]bool) {
+	s := NewSet(opts...)
+	m := map[string]bool{}
+	for range n {
+		key := make([]byte, 1+r.Intn(4))
+		for i := range key {
+			key[i] = "\x00\x01\x0f\x10\x11ab\xff"[r.Intn(8)]
+		}
+		s.Add(key)
+		m[string(key)] = true
+	}
+	return s, m
+}
+
+func checkSet(t *testing.T, s *Set, m map[string]bool) {
+	t.Helper()
+	if err := s.tr.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Size() != len(m) {
+		t.Fatalf("Size got %d want %d", s.Size(), len(m))
+	}
+	n := 0
+	var prev []byte
+	it := s.Iterator()
+	for {
+		k, ok := it.Next()
+		if !ok {
+			break
+		}
+		if !m[string(k)] {
+			t.Fatalf("unexpected key %q", k)
+		}
+		if prev != nil && bytes.Compare(prev, k) >= 0 {
+			t.Fatalf("keys out of order: %q, %q", prev, k)
+		}
+		prev = k
+		n++
+	}
+	if n != len(m) {
+		t.Fatalf("iterated %d keys want %d", n, len(m))
+	}
+}
+
+func Test_SetAddRemove(t *testing.T) {
+	s := NewSet()
+	if !s.Add([]byte("a")) || s.Add([]byte("a")) || !s.Add([]byte("ab")) {
+		t.Fatal("Add")
+	}
+	if !s.Has([]byte("a")) || s.Has([]byte("b")) {
+		t.Fatal("Has")
+	}
+	if !s.Remove([]byte("a")) || s.Remove([]byte("a")) {
+		t.Fatal("Remove")
+	}
+	checkSet(t, s, map[string]bool{"ab": true})
+
+	it := s.Iterator()
+	it.Seek([]byte("b"))
+	if k, ok := it.Next(); ok {
+		t.Fatalf("Seek past the end got %q", k)
+	}
+}
+
+func Test_SetAlgebra(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for round := range 300 {
+		var opts []Option
+		if round%2 == 1 {
+			opts = append(opts, WithNodePool())
+		}
+		a, ma := randSet(r, r.Intn(60), opts...)
+		b, mb := randSet(r, r.Intn(60), opts...)
+		if round%5 == 0 {
+			// b starts out sharing most of its nodes with a.
+			b = NewSet(opts...)
+			b.tr.snapshotOf(&a.tr)
+			mb = map[string]bool{}
+			for k := range ma {
+				mb[k] = true
+			}
+			_, me := randSet(r, 5)
+			for k := range me {
+				b.Add([]byte(k))
+				mb[k] = true
+			}
+			for k := range ma {
+				if r.Intn(4) == 0 {
+					b.Remove([]byte(k))
+					delete(mb, k)
+				}
+			}
+		}
+
+		union, inter, diff := map[string]bool{}, map[string]bool{}, map[string]bool{}
+		for k := range ma {
+			union[k] = true
+			if mb[k] {
+				inter[k] = true
+			} else {
+				diff[k] = true
+			}
+		}
+		for k := range mb {
+			union[k] = true
+		}
+
+		u, i, d := a.Union(b), a.Intersect(b), a.Difference(b)
+		checkSet(t, u, union)
+		checkSet(t, i, inter)
+		checkSet(t, d, diff)
+		if got, want := a.IsSubset(b), len(diff) == 0; got != want {
+			t.Fatalf("IsSubset got %v want %v", got, want)
+		}
+		if !i.IsSubset(a) || !i.IsSubset(b) || !a.IsSubset(u) || !b.IsSubset(u) || !d.IsSubset(a) {
+			t.Fatal("IsSubset of derived sets")
+		}
+
+		// Results and operands share nodes but not changes.
+		for k := range union {
+			u.Remove([]byte(k))
+			i.Add([]byte(k + "x"))
+			d.Add([]byte(k + "y"))
+		}
+		checkSet(t, a, ma)
+		checkSet(t, b, mb)
+		for k := range ma {
+			a.Remove([]byte(k))
+		}
+		checkSet(t, u, map[string]bool{})
+		checkSet(t, b, mb)
+	}
+}
+
+func Test_SetNodeSize(t *testing.T) {
+	if got, want := unsafe.Sizeof(gnode[struct{}]{}), unsafe.Sizeof(node{})-unsafe.Sizeof(any(nil)); got != want {
+		t.Errorf("set node size got %d want %d", got, want)
+	}
+}
+
+func Test_SetWords(t *testing.T) {
+	words := loadTestData(wordsPath)
+	a, b := NewSet(), NewSet()
+	for i, w := range words {
+		if i%2 == 0 {
+			a.Add(w)
+		}
+		if i%3 == 0 {
+			b.Add(w)
+		}
+	}
+	u, i, d := a.Union(b), a.Intersect(b), a.Difference(b)
+	if u.Size()+i.Size() != a.Size()+b.Size() || d.Size()+i.Size() != a.Size() {
+		t.Fatalf("sizes union %d intersect %d difference %d", u.Size(), i.Size(), d.Size())
+	}
+	for j, w := range words {
+		if u.Has(w) != (j%2 == 0 || j%3 == 0) || i.Has(w) != (j%6 == 0) || d.Has(w) != (j%2 == 0 && j%3 != 0) {
+			t.Fatalf("word %q", w)
+		}
+	}
+}
+
+func Benchmark_Words_SetUnion(b *testing.B) {
+	words := loadTestData(wordsPath)
+	s1, s2 := NewSet(), NewSet()
+	for i, w := range words {
+		if i%2 == 0 {
+			s1.Add(w)
+		} else {
+			s2.Add(w)
+		}
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		s1.Union(s2)
+	}
+}
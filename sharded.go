@@ -0,0 +1,203 @@
+package qp
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ShardedTrie splits the key space into ranges of leading bytes, each held by
+// its own trie behind its own lock, so writers to different ranges do not
+// wait for each other. Shard i holds keys whose first byte is in
+// [bounds[i], bounds[i+1]), so the shards are ordered and a global ordered
+// traversal visits them one after the other.
+type ShardedTrie struct {
+	shards []shard
+	bounds []int      // first byte of each shard, ascending, bounds[0] == 0
+	lookup [256]uint8 // shard of each first byte
+}
+
+type shard struct {
+	mu sync.RWMutex
+	tr *Trie
+}
+
+// NewSharded creates a ShardedTrie with n shards (1 <= n <= 256) covering
+// equal ranges of leading bytes. opts apply to every shard.
+func NewSharded(n int, opts ...Option) *ShardedTrie {
+	if n < 1 || n > 256 {
+		panic(fmt.Errorf("shard count %d out of range [1, 256]", n))
+	}
+	st := &ShardedTrie{
+		shards: make([]shard, n),
+		bounds: make([]int, n),
+	}
+	for i := range st.shards {
+		st.shards[i].tr = New(opts...)
+		st.bounds[i] = i * 256 / n
+	}
+	for i := range n {
+		end := 256
+		if i+1 < n {
+			end = st.bounds[i+1]
+		}
+		for b := st.bounds[i]; b < end; b++ {
+			st.lookup[b] = uint8(i)
+		}
+	}
+	return st
+}
+
+func (st *ShardedTrie) shardOf(key []byte) int {
+	must(key)
+	return int(st.lookup[key[0]])
+}
+
+// Get retrieves the value associated with the given key.
+func (st *ShardedTrie) Get(key []byte) (val any, found bool) {
+	s := &st.shards[st.shardOf(key)]
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tr.Get(key)
+}
+
+// Upsert inserts or updates a key-value pair, locking only the key's shard.
+func (st *ShardedTrie) Upsert(key []byte, value any) (oldVal any, isUpdate bool) {
+	s := &st.shards[st.shardOf(key)]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tr.Upsert(key, value)
+}
+
+// Delete removes the entry for the given key, locking only the key's shard.
+func (st *ShardedTrie) Delete(key []byte) (oldVal any, found bool) {
+	s := &st.shards[st.shardOf(key)]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tr.Delete(key)
+}
+
+// Size returns the total number of keys. Shards are counted one at a time,
+// so concurrent writes may or may not be included.
+func (st *ShardedTrie) Size() int {
+	size := 0
+	for i := range st.shards {
+		s := &st.shards[i]
+		s.mu.RLock()
+		size += s.tr.Size()
+		s.mu.RUnlock()
+	}
+	return size
+}
+
+// GetLessOrEqual returns the largest key less than or equal to key, looking
+// into the preceding shards when the key's own shard has none. Shards are
+// locked one at a time; use Snapshot for a consistent answer under writes.
+func (st *ShardedTrie) GetLessOrEqual(key []byte) (k []byte, v any, exactMatch bool) {
+	for i := st.shardOf(key); i >= 0; i-- {
+		s := &st.shards[i]
+		s.mu.RLock()
+		k, v, exactMatch = shardLessOrEqual(s.tr, key, i == st.shardOf(key))
+		s.mu.RUnlock()
+		if k != nil {
+			return k, v, exactMatch
+		}
+	}
+	return nil, nil, false
+}
+
+// shardLessOrEqual searches tr for key if own, otherwise returns the last key
+// of tr, which precedes every key of the later shard key belongs to.
+func shardLessOrEqual(tr *Trie, key []byte, own bool) (k []byte, v any, exactMatch bool) {
+	if own {
+		return tr.GetLessOrEqual(key)
+	}
+	if tr.root.isNil() {
+		return nil, nil, false
+	}
+	leaf := tr.root.lastLeaf()
+	return leaf.key(), leaf.val, false
+}
+
+// Snapshot returns a consistent read-only view of all shards. It holds every
+// shard lock only while sharing the shards' roots, and later writes to the
+// ShardedTrie copy the nodes they change instead of modifying the snapshot.
+func (st *ShardedTrie) Snapshot() *ShardedSnapshot {
+	for i := range st.shards {
+		st.shards[i].mu.Lock()
+	}
+	snap := &ShardedSnapshot{st: st, tries: make([]*Trie, len(st.shards))}
+	for i := range st.shards {
+		snap.tries[i] = st.shards[i].tr.snapshot()
+	}
+	for i := range st.shards {
+		st.shards[i].mu.Unlock()
+	}
+	return snap
+}
+
+// Iterator returns an iterator over a snapshot of all shards in key order.
+func (st *ShardedTrie) Iterator() *ShardedIterator {
+	return st.Snapshot().Iterator()
+}
+
+// ShardedSnapshot is a point-in-time view of a ShardedTrie. It is safe for
+// concurrent readers and must not be modified.
+type ShardedSnapshot struct {
+	st    *ShardedTrie
+	tries []*Trie
+}
+
+// Get retrieves the value associated with the given key.
+func (snap *ShardedSnapshot) Get(key []byte) (val any, found bool) {
+	return snap.tries[snap.st.shardOf(key)].Get(key)
+}
+
+// Size returns the total number of keys in the snapshot.
+func (snap *ShardedSnapshot) Size() int {
+	size := 0
+	for _, tr := range snap.tries {
+		size += tr.Size()
+	}
+	return size
+}
+
+// GetLessOrEqual returns the largest key less than or equal to key.
+func (snap *ShardedSnapshot) GetLessOrEqual(key []byte) (k []byte, v any, exactMatch bool) {
+	own := snap.st.shardOf(key)
+	for i := own; i >= 0; i-- {
+		if k, v, exactMatch = shardLessOrEqual(snap.tries[i], key, i == own); k != nil {
+			return k, v, exactMatch
+		}
+	}
+	return nil, nil, false
+}
+
+// Iterator returns an iterator over all keys of the snapshot in order.
+func (snap *ShardedSnapshot) Iterator() *ShardedIterator {
+	it := &ShardedIterator{snap: snap}
+	it.it.Reset(snap.tries[0])
+	return it
+}
+
+// ShardedIterator iterates a ShardedSnapshot in key order. Since shards hold
+// ascending disjoint key ranges, merging them amounts to draining one shard
+// after the other.
+type ShardedIterator struct {
+	snap  *ShardedSnapshot
+	shard int
+	it    Iterator
+}
+
+// Next returns the next key-value pair, or ok=false at the end.
+func (it *ShardedIterator) Next() (key []byte, value any, ok bool) {
+	for {
+		if key, value, ok = it.it.Next(); ok {
+			return key, value, true
+		}
+		if it.shard+1 >= len(it.snap.tries) {
+			return nil, nil, false
+		}
+		it.shard++
+		it.it.Reset(it.snap.tries[it.shard])
+	}
+}
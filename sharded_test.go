@@ -0,0 +1,147 @@
+package qp
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func Test_ShardedTrie(t *testing.T) {
+	words := loadTestData(wordsSortedPath)
+	st := NewSharded(7)
+	for i, w := range words {
+		st.Upsert(w, i)
+	}
+	st.Upsert([]byte{0}, -1)
+	st.Upsert([]byte{0xff, 0xff}, -2)
+	if st.Size() != len(words)+2 {
+		t.Fatalf("Size got %d want %d", st.Size(), len(words)+2)
+	}
+	for i, w := range words {
+		if v, ok := st.Get(w); !ok || v != i {
+			t.Fatalf("Get(%q) got %v, %v", w, v, ok)
+		}
+	}
+
+	it := st.Iterator()
+	expect := append(append([][]byte{{0}}, words...), []byte{0xff, 0xff})
+	for i, w := range expect {
+		k, _, ok := it.Next()
+		if !ok || !bytes.Equal(k, w) {
+			t.Fatalf("Next %d got %q, %v want %q", i, k, ok, w)
+		}
+	}
+	if _, _, ok := it.Next(); ok {
+		t.Fatalf("iterator should be exhausted")
+	}
+
+	if v, found := st.Delete([]byte{0}); !found || v != -1 {
+		t.Fatalf("Delete got %v, %v", v, found)
+	}
+	if _, found := st.Get([]byte{0}); found {
+		t.Fatalf("deleted key still found")
+	}
+}
+
+func Test_ShardedGetLessOrEqual(t *testing.T) {
+	st := NewSharded(16)
+	for _, k := range []string{"\x05", "\x05a", "A", "Az", "\xf0"} {
+		st.Upsert([]byte(k), k)
+	}
+	snap := st.Snapshot()
+	tests := []struct {
+		search, expect string
+		exact          bool
+	}{
+		{"\x01", "", false},
+		{"\x05", "\x05", true},
+		{"\x06", "\x05a", false},
+		{"@", "\x05a", false},
+		{"B", "Az", false},
+		{"\xe0", "Az", false},
+		{"\xf0", "\xf0", true},
+		{"\xff", "\xf0", false},
+	}
+	for _, tt := range tests {
+		for name, get := range map[string]func([]byte) ([]byte, any, bool){
+			"trie":     st.GetLessOrEqual,
+			"snapshot": snap.GetLessOrEqual,
+		} {
+			k, _, exact := get([]byte(tt.search))
+			if string(k) != tt.expect || exact != tt.exact {
+				t.Errorf("%s GetLessOrEqual(%q) got %q, %v want %q, %v", name, tt.search, k, exact, tt.expect, tt.exact)
+			}
+		}
+	}
+}
+
+func Test_ShardedConcurrent(t *testing.T) {
+	st := NewSharded(8, WithNodePool())
+	// The first byte of the keys of goroutine g falls into shard g.
+	shardKey := func(g, i int) []byte {
+		return fmt.Appendf([]byte{byte(g*32 + i%32)}, "-%d", i)
+	}
+	for i := 0; i < 1000; i++ {
+		st.Upsert(shardKey(i%8, i), 0)
+	}
+	snap := st.Snapshot()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := shardKey(g, i)
+				if st.shardOf(key) != g {
+					t.Errorf("key %q in shard %d, want %d", key, st.shardOf(key), g)
+					return
+				}
+				st.Upsert(key, g)
+				st.Get(key)
+				if i%3 == 0 {
+					st.Delete(key)
+				}
+			}
+		}(g)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			s := st.Snapshot()
+			n := 0
+			it := s.Iterator()
+			for {
+				if _, _, ok := it.Next(); !ok {
+					break
+				}
+				n++
+			}
+			if n != s.Size() {
+				t.Errorf("snapshot iterated %d keys, Size %d", n, s.Size())
+			}
+		}
+	}()
+	wg.Wait()
+
+	if snap.Size() != 1000 {
+		t.Fatalf("old snapshot Size got %d want 1000", snap.Size())
+	}
+	it := snap.Iterator()
+	for {
+		_, v, ok := it.Next()
+		if !ok {
+			break
+		}
+		if v != 0 {
+			t.Fatalf("old snapshot sees a later write: %v", v)
+		}
+	}
+	for i := range st.shards {
+		if err := st.shards[i].tr.Validate(); err != nil {
+			t.Fatalf("shard %d: %v", i, err)
+		}
+	}
+}
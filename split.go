@@ -0,0 +1,84 @@
+package qp
+
+import (
+	"bytes"
+	"errors"
+)
+
+var errJoinOverlap = errors.New("qp: keys of left are not all less than keys of right")
+
+// Split returns a trie with the keys of tr less than key and one with the rest.
+// Only the branches on the search path of key are copied; every other subtree
+// is shared copy-on-write with tr, which is not changed. The sizes come from
+// the leaf counts of the branches, so Split takes time in proportion to the
+// depth of key, not to the size of tr.
+func (tr *Trie) Split(key []byte) (left, right *Trie) {
+	must(key)
+	left, right = tr.derive(), tr.derive()
+	if tr.root.isNil() {
+		return left, right
+	}
+	tr.share()
+	var m merger[any] // the new tries' pools are empty, so nothing to take from
+	left.root, right.root = m.split(&tr.root, key)
+	if !left.root.isNil() {
+		left.size = countLeaves(&left.root)
+	}
+	right.size = tr.size - left.size
+	return left, right
+}
+
+// split returns the keys under n less than key and the rest.
+func (m *merger[V]) split(n *gnode[V], key []byte) (l, r gnode[V]) {
+	k := n.firstLeaf().key()
+	if !n.isBranch() || divergeIndex(key, k) < n.index() {
+		// key is not inside n's key range: all of n goes to one side.
+		if bytes.Compare(k, key) < 0 {
+			return adopt(n), gnode[V]{}
+		}
+		return gnode[V]{}, adopt(n)
+	}
+
+	var lt, rt [maxTwigs]gnode[V]
+	var lBits, rBits bitmapT
+	nl, nr := 0, 0
+	b := n.twigBit(key)
+	for rest := n.bitmap(); rest != 0; {
+		bit := rest & -rest
+		rest &^= bit
+		t := n.twig(n.twigOffset(bit))
+		var lo, hi gnode[V]
+		switch {
+		case bit < b:
+			lo = adopt(t)
+		case bit > b:
+			hi = adopt(t)
+		default:
+			lo, hi = m.split(t, key)
+		}
+		if !lo.isNil() {
+			lt[nl], lBits = lo, lBits|bit
+			nl++
+		}
+		if !hi.isNil() {
+			rt[nr], rBits = hi, rBits|bit
+			nr++
+		}
+	}
+	return m.branch(n.index(), lBits, lt[:nl]), m.branch(n.index(), rBits, rt[:nr])
+}
+
+// Join returns a trie with the keys of left and right, which must all be less
+// than the keys of right. Only the branches along the boundary between the two
+// key ranges are copied; both tries are shared copy-on-write and not changed.
+// The result has the options of left.
+func Join(left, right *Trie) (*Trie, error) {
+	if !left.root.isNil() && !right.root.isNil() {
+		last := left.root.lastLeaf().key()
+		first := right.root.firstLeaf().key()
+		if bytes.Compare(last, first) >= 0 {
+			return nil, errJoinOverlap
+		}
+	}
+	return left.union(right, nil), nil
+}
@@ -0,0 +1,107 @@
+package qp
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func Test_SplitJoin(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for round := range 300 {
+		var opts []Option
+		if round%2 == 1 {
+			opts = append(opts, WithNodePool())
+		}
+		tr := New(opts...)
+		m := map[string]any{}
+		for range r.Intn(60) {
+			key := make([]byte, 1+r.Intn(4))
+			for i := range key {
+				key[i] = "\x00\x01\x0f\x10\x11ab\xff"[r.Intn(8)]
+			}
+			tr.Upsert(key, round)
+			m[string(key)] = round
+		}
+		at := make([]byte, 1+r.Intn(3))
+		for i := range at {
+			at[i] = "\x00\x01\x0f\x10\x11ab\xff"[r.Intn(8)]
+		}
+
+		left, right := tr.Split(at)
+		ml, mr := map[string]any{}, map[string]any{}
+		for k, v := range m {
+			if bytes.Compare([]byte(k), at) < 0 {
+				ml[k] = v
+			} else {
+				mr[k] = v
+			}
+		}
+		for _, x := range []*Trie{left, right} {
+			if err := x.Validate(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		checkTrie(t, left, ml)
+		checkTrie(t, right, mr)
+
+		joined, err := Join(left, right)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = joined.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		checkTrie(t, joined, m)
+		if len(ml) > 0 && len(mr) > 0 {
+			if _, err = Join(right, left); err == nil {
+				t.Fatal("Join of overlapping tries succeeded")
+			}
+		}
+
+		for k := range m {
+			left.Delete([]byte(k))
+			right.Upsert([]byte(k), -1)
+		}
+		checkTrie(t, tr, m)
+		checkTrie(t, joined, m)
+	}
+}
+
+func Test_SplitWords(t *testing.T) {
+	words := loadTestData(wordsPath)
+	tr := New()
+	for _, w := range words {
+		tr.Upsert(w, nil)
+	}
+	left, right := tr.Split([]byte("m"))
+	if left.Size()+right.Size() != tr.Size() {
+		t.Fatalf("sizes %d + %d want %d", left.Size(), right.Size(), tr.Size())
+	}
+	k, _, _ := left.GetLessOrEqual([]byte("m"))
+	if bytes.Compare(k, []byte("m")) >= 0 {
+		t.Fatalf("left holds %q", k)
+	}
+	it := right.Iterator()
+	if k, _, _ = it.Next(); bytes.Compare(k, []byte("m")) < 0 {
+		t.Fatalf("right holds %q", k)
+	}
+	joined, err := Join(left, right)
+	if err != nil || joined.Size() != tr.Size() {
+		t.Fatalf("Join: %v, size %d", err, joined.Size())
+	}
+}
+
+func Benchmark_Words_Split(b *testing.B) {
+	tr := New()
+	words := loadTestData(wordsPath)
+	for _, w := range words {
+		tr.Upsert(w, nil)
+	}
+	b.ReportAllocs()
+	i := 0
+	for b.Loop() {
+		tr.Split(words[i%len(words)])
+		i += 7919
+	}
+}
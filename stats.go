@@ -0,0 +1,89 @@
+package qp
+
+import "unsafe"
+
+// Stats describes the shape of a trie.
+type Stats struct {
+	Branches int
+	Leaves   int
+	// Depth[d] is the number of leaves below d branches.
+	Depth []int
+	// FanOut[n] is the number of branches with n twigs.
+	FanOut [maxTwigs + 1]int
+	// KeyBytes is the total length of all keys.
+	KeyBytes int
+	// HeapBytes estimates the memory held by the trie: its nodes and key bytes,
+	// but not what values point to. Keys shared with the caller are counted too.
+	HeapBytes int
+}
+
+// Stats walks the trie and returns its statistics.
+func (tr *Trie) Stats() Stats {
+	var s Stats
+	s.HeapBytes = int(unsafe.Sizeof(*tr))
+	if !tr.root.isNil() {
+		s.add(&tr.root, 0)
+	}
+	return s
+}
+
+func (s *Stats) add(n *node, depth int) {
+	if !n.isBranch() {
+		s.Leaves++
+		for len(s.Depth) <= depth {
+			s.Depth = append(s.Depth, 0)
+		}
+		s.Depth[depth]++
+		s.KeyBytes += len(n.key())
+		s.HeapBytes += len(n.key())
+		return
+	}
+	twigs := n.twigs()
+	s.Branches++
+	s.FanOut[len(twigs)]++
+	s.HeapBytes += len(twigs) * int(unsafe.Sizeof(node{}))
+	for i := range twigs {
+		s.add(&twigs[i], depth+1)
+	}
+}
+
+// SharedNodes returns how many nodes of tr are shared with snapshot, typically
+// the other side of a Txn. Shared nodes take no additional memory.
+func (tr *Trie) SharedNodes(snapshot *Trie) int {
+	arrays := make(map[unsafe.Pointer]struct{})
+	var collect func(n *node)
+	collect = func(n *node) {
+		if !n.isBranch() {
+			return
+		}
+		arrays[n.ptr] = struct{}{}
+		twigs := n.twigs()
+		for i := range twigs {
+			collect(&twigs[i])
+		}
+	}
+	if !snapshot.root.isNil() {
+		collect(&snapshot.root)
+	}
+
+	var count func(n *node, shared bool) int
+	count = func(n *node, shared bool) int {
+		c := 0
+		if shared {
+			c++
+		}
+		if !n.isBranch() {
+			return c
+		}
+		_, ok := arrays[n.ptr]
+		twigs := n.twigs()
+		for i := range twigs {
+			c += count(&twigs[i], shared || ok)
+		}
+		return c
+	}
+	if tr.root.isNil() {
+		return 0
+	}
+	return count(&tr.root, false)
+}
@@ -0,0 +1,83 @@
+package qp
+
+import (
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func Test_Stats(t *testing.T) {
+	tr := New()
+	if s := tr.Stats(); s.Branches != 0 || s.Leaves != 0 || s.Depth != nil {
+		t.Fatalf("empty trie stats %+v", s)
+	}
+
+	tr.Upsert([]byte("a"), value1)
+	tr.Upsert([]byte("b"), value1)
+	tr.Upsert([]byte("bc"), value1)
+	s := tr.Stats()
+	expect := Stats{
+		Branches:  2,
+		Leaves:    3,
+		Depth:     []int{0, 1, 2},
+		KeyBytes:  4,
+		HeapBytes: int(unsafe.Sizeof(*tr)) + 4*int(unsafe.Sizeof(node{})) + 4,
+	}
+	expect.FanOut[2] = 2
+	if !reflect.DeepEqual(s, expect) {
+		t.Fatalf("Stats got %+v want %+v", s, expect)
+	}
+
+	words := loadTestData(wordsPath)
+	tr = New()
+	keyBytes := 0
+	for _, w := range words {
+		tr.Upsert(w, nil)
+		keyBytes += len(w)
+	}
+	s = tr.Stats()
+	if s.Leaves != tr.Size() || s.KeyBytes != keyBytes {
+		t.Fatalf("Leaves %d KeyBytes %d want %d %d", s.Leaves, s.KeyBytes, tr.Size(), keyBytes)
+	}
+	leaves, branches, twigs := 0, 0, 0
+	for _, n := range s.Depth {
+		leaves += n
+	}
+	for n, c := range s.FanOut {
+		branches += c
+		twigs += n * c
+	}
+	if leaves != s.Leaves || branches != s.Branches || twigs != s.Branches+s.Leaves-1 {
+		t.Fatalf("inconsistent stats %+v", s)
+	}
+}
+
+func Test_SharedNodes(t *testing.T) {
+	words := loadTestData(wordsPath)[:5000]
+	tr := New()
+	for _, w := range words {
+		tr.Upsert(w, nil)
+	}
+	s := tr.Stats()
+	all := s.Branches + s.Leaves - 1
+
+	if n := tr.SharedNodes(New()); n != 0 {
+		t.Fatalf("SharedNodes with empty trie = %d", n)
+	}
+	if n := tr.SharedNodes(tr); n != all {
+		t.Fatalf("SharedNodes with itself = %d want %d", n, all)
+	}
+
+	tx := tr.Txn()
+	if n := tx.newTr.SharedNodes(tr); n != all {
+		t.Fatalf("SharedNodes before writes = %d want %d", n, all)
+	}
+	tx.Upsert([]byte("zzzz"), nil)
+	n := tx.newTr.SharedNodes(tr)
+	if n == 0 || n >= all {
+		t.Fatalf("SharedNodes after a write = %d, all %d", n, all)
+	}
+	if m := tr.SharedNodes(tx.newTr); m != n {
+		t.Fatalf("SharedNodes is not symmetric here: %d vs %d", m, n)
+	}
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/gnosnah/qp"
+)
+
+// A snapshot file is
+//
+//	magic | uvarint count | count * (uvarint len(key) | key | uvarint len(val) | val) | crc32c uint32 LE
+//
+// where the checksum covers everything before it. Snapshots are written to a
+// temporary file and renamed into place, so a crash never leaves a torn one.
+
+var (
+	snapshotMagic = []byte("qpsnap01")
+
+	errCorruptSnapshot = errors.New("corrupt snapshot")
+)
+
+func writeSnapshot(path string, tr *qp.Trie) (err error) {
+	f, err := openFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	h := crc32.New(crcTable)
+	w := bufio.NewWriter(io.MultiWriter(f, h))
+	var buf []byte
+	buf = append(buf, snapshotMagic...)
+	buf = binary.AppendUvarint(buf, uint64(tr.Size()))
+	it := tr.Iterator()
+	for {
+		k, v, ok := it.Next()
+		if !ok {
+			break
+		}
+		val := v.([]byte)
+		buf = binary.AppendUvarint(buf, uint64(len(k)))
+		buf = append(buf, k...)
+		buf = binary.AppendUvarint(buf, uint64(len(val)))
+		buf = append(buf, val...)
+		if _, err = w.Write(buf); err != nil {
+			return err
+		}
+		buf = buf[:0]
+	}
+	if _, err = w.Write(buf); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if _, err = f.Write(binary.LittleEndian.AppendUint32(nil, h.Sum32())); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// loadSnapshot returns an empty trie if the snapshot does not exist.
+func loadSnapshot(path string) (*qp.Trie, error) {
+	tr := qp.New()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tr, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < len(snapshotMagic)+4 || !bytes.HasPrefix(data, snapshotMagic) {
+		return nil, errCorruptSnapshot
+	}
+	body, tail := data[:len(data)-4], data[len(data)-4:]
+	if crc32.Checksum(body, crcTable) != binary.LittleEndian.Uint32(tail) {
+		return nil, errCorruptSnapshot
+	}
+
+	body = body[len(snapshotMagic):]
+	count, w := binary.Uvarint(body)
+	if w <= 0 {
+		return nil, errCorruptSnapshot
+	}
+	body = body[w:]
+	for i := uint64(0); i < count; i++ {
+		var k, v []byte
+		var ok bool
+		if k, body, ok = readBytes(body); !ok || len(k) == 0 {
+			return nil, errCorruptSnapshot
+		}
+		if v, body, ok = readBytes(body); !ok {
+			return nil, errCorruptSnapshot
+		}
+		tr.Upsert(k, v)
+	}
+	if len(body) != 0 {
+		return nil, errCorruptSnapshot
+	}
+	return tr, nil
+}
@@ -0,0 +1,354 @@
+// Package store persists a qp trie to a local directory.
+//
+// Every committed transaction is appended to a write-ahead log and synced
+// before it becomes visible. A snapshot of the whole trie is written from
+// time to time, after which the log is truncated. Open replays the snapshot
+// and the log, discarding a torn or corrupt record at the tail of the log.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gnosnah/qp"
+)
+
+const (
+	walFileName      = "wal"
+	snapshotFileName = "snapshot"
+	snapshotTmpName  = "snapshot.tmp"
+)
+
+var (
+	errClosed = errors.New("store closed")
+	errTxnEnd = errors.New("transaction already committed or aborted")
+)
+
+// file is the subset of *os.File used by the store, so tests can inject faults.
+type file interface {
+	Read(p []byte) (n int, err error)
+	Write(p []byte) (n int, err error)
+	Seek(offset int64, whence int) (int64, error)
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+var openFile = func(name string, flag int, perm os.FileMode) (file, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+type Option func(*Store)
+
+// WithSnapshotEvery writes a snapshot and truncates the log after every n commits.
+// n <= 0 disables periodic snapshots; Snapshot can still be called explicitly.
+func WithSnapshotEvery(n int) Option {
+	return func(s *Store) {
+		s.snapshotEvery = n
+	}
+}
+
+// Store is a durable key-value store backed by a qp trie.
+// Keys and values are byte slices. Reads may run concurrently with a single writer.
+type Store struct {
+	dir string
+
+	mu sync.RWMutex // guards tr
+	tr *qp.Trie
+
+	wmu           sync.Mutex // serializes writers, held for the lifetime of a Txn
+	wal           file
+	walSize       int64
+	commits       int // commits since the last snapshot
+	snapshotEvery int
+	err           error // sticky error after a failed log write
+}
+
+// Open opens the store in dir, creating the directory if needed.
+// The trie is rebuilt from the snapshot followed by the write-ahead log.
+// A torn or corrupt record at the end of the log is truncated away.
+func Open(dir string, opts ...Option) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	tr, err := loadSnapshot(filepath.Join(dir, snapshotFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	wal, err := openFile(filepath.Join(dir, walFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	size, err := replayWAL(wal, tr)
+	if err != nil {
+		_ = wal.Close()
+		return nil, err
+	}
+	s.tr = tr
+	s.wal = wal
+	s.walSize = size
+	return s, nil
+}
+
+// Get returns the value stored under key.
+// The returned slice must not be modified.
+func (s *Store) Get(key []byte) (val []byte, found bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, found := s.tr.Get(key)
+	if !found {
+		return nil, false
+	}
+	return v.([]byte), true
+}
+
+// Size returns the number of keys in the store.
+func (s *Store) Size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tr.Size()
+}
+
+// Trie returns the current committed trie. It must be treated as read-only.
+func (s *Store) Trie() *qp.Trie {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tr
+}
+
+// Put stores a single key-value pair in its own transaction.
+func (s *Store) Put(key, val []byte) error {
+	if err := qp.CheckKey(key); err != nil {
+		return err
+	}
+	tx := s.Txn()
+	if err := tx.Put(key, val); err != nil {
+		tx.Abort()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete removes a single key in its own transaction.
+func (s *Store) Delete(key []byte) error {
+	if err := qp.CheckKey(key); err != nil {
+		return err
+	}
+	tx := s.Txn()
+	tx.Delete(key)
+	return tx.Commit()
+}
+
+// Txn starts a write transaction. Only one transaction can be open at a time;
+// Txn blocks until the previous one is committed or aborted.
+func (s *Store) Txn() *Txn {
+	s.wmu.Lock()
+	s.mu.Lock()
+	qtx := s.tr.Txn()
+	s.mu.Unlock()
+	return &Txn{s: s, tx: qtx}
+}
+
+// Snapshot writes the whole trie to a new snapshot file and truncates the log.
+func (s *Store) Snapshot() error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	return s.snapshot()
+}
+
+func (s *Store) snapshot() error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.wal == nil {
+		return errClosed
+	}
+	tmp := filepath.Join(s.dir, snapshotTmpName)
+	if err := writeSnapshot(tmp, s.Trie()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, snapshotFileName)); err != nil {
+		return err
+	}
+	if err := syncDir(s.dir); err != nil {
+		return err
+	}
+	// Crashing before the truncation is harmless: replaying the log on top
+	// of a snapshot that already contains it yields the same trie.
+	if err := s.wal.Truncate(0); err != nil {
+		s.err = fmt.Errorf("truncate wal: %w", err)
+		return s.err
+	}
+	if _, err := s.wal.Seek(0, 0); err != nil {
+		s.err = fmt.Errorf("seek wal: %w", err)
+		return s.err
+	}
+	if err := s.wal.Sync(); err != nil {
+		s.err = fmt.Errorf("sync wal: %w", err)
+		return s.err
+	}
+	s.walSize = 0
+	s.commits = 0
+	return nil
+}
+
+// Close closes the log file. The store must not be used afterwards.
+func (s *Store) Close() error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	if s.wal == nil {
+		return errClosed
+	}
+	err := s.wal.Close()
+	s.wal = nil
+	return err
+}
+
+func (s *Store) commit(tx *Txn) error {
+	if s.err != nil {
+		tx.tx.Abort()
+		return s.err
+	}
+	if s.wal == nil {
+		tx.tx.Abort()
+		return errClosed
+	}
+	if len(tx.ops) == 0 {
+		tx.tx.Abort()
+		return nil
+	}
+
+	rec := encodeRecord(tx.ops)
+	if len(rec)-recordHeaderSize > int(maxRecordSize) {
+		tx.tx.Abort()
+		return errRecordTooLarge
+	}
+	if _, err := s.wal.Write(rec); err != nil {
+		tx.tx.Abort()
+		s.rollbackWAL()
+		return fmt.Errorf("write wal: %w", err)
+	}
+	if err := s.wal.Sync(); err != nil {
+		tx.tx.Abort()
+		s.rollbackWAL()
+		return fmt.Errorf("sync wal: %w", err)
+	}
+	s.walSize += int64(len(rec))
+
+	s.mu.Lock()
+	s.tr = tx.tx.Commit()
+	s.mu.Unlock()
+
+	s.commits++
+	if s.snapshotEvery > 0 && s.commits >= s.snapshotEvery {
+		return s.snapshot()
+	}
+	return nil
+}
+
+// rollbackWAL drops a partially written record. If that fails too the log
+// is in an unknown state and the store refuses further writes.
+func (s *Store) rollbackWAL() {
+	if err := s.wal.Truncate(s.walSize); err != nil {
+		s.err = fmt.Errorf("truncate wal: %w", err)
+		return
+	}
+	if _, err := s.wal.Seek(s.walSize, 0); err != nil {
+		s.err = fmt.Errorf("seek wal: %w", err)
+	}
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = d.Close()
+	}()
+	return d.Sync()
+}
+
+// Txn is a write transaction on a Store.
+type Txn struct {
+	s    *Store
+	tx   *qp.Txn
+	ops  []op
+	done bool
+}
+
+// Get returns the value of key as seen by the transaction. Once the
+// transaction has ended, no key is found.
+func (tx *Txn) Get(key []byte) (val []byte, found bool) {
+	if tx.done {
+		return nil, false
+	}
+	v, found := tx.tx.Get(key)
+	if !found {
+		return nil, false
+	}
+	return v.([]byte), true
+}
+
+// Put stores a copy of key and val. It returns an error, leaving the
+// transaction unchanged, if the key is empty or too long, or if the
+// transaction has ended.
+func (tx *Txn) Put(key, val []byte) error {
+	if tx.done {
+		return errTxnEnd
+	}
+	if err := qp.CheckKey(key); err != nil {
+		return err
+	}
+	key = append([]byte(nil), key...)
+	val = append([]byte{}, val...)
+	tx.tx.Upsert(key, val)
+	tx.ops = append(tx.ops, op{kind: opPut, key: key, val: val})
+	return nil
+}
+
+// Delete removes key. It reports whether the key was present, which an
+// empty or too long key never is, nor any key once the transaction has ended.
+func (tx *Txn) Delete(key []byte) bool {
+	if tx.done || qp.CheckKey(key) != nil {
+		return false
+	}
+	key = append([]byte(nil), key...)
+	_, found := tx.tx.Delete(key)
+	if found {
+		tx.ops = append(tx.ops, op{kind: opDelete, key: key})
+	}
+	return found
+}
+
+// Commit appends the transaction to the log, syncs it and publishes the new trie.
+// If the transaction is too large for one log record, or the log write fails,
+// the transaction is discarded and the store keeps its previous state. An error from a periodic snapshot is returned after the
+// transaction itself has been made durable.
+func (tx *Txn) Commit() error {
+	if tx.done {
+		return errTxnEnd
+	}
+	tx.done = true
+	defer tx.s.wmu.Unlock()
+	return tx.s.commit(tx)
+}
+
+// Abort discards the transaction.
+func (tx *Txn) Abort() {
+	if tx.done {
+		return
+	}
+	tx.done = true
+	tx.tx.Abort()
+	tx.s.wmu.Unlock()
+}
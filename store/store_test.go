@@ -0,0 +1,461 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func dump(s *Store) map[string]string {
+	m := make(map[string]string)
+	it := s.Trie().Iterator()
+	for {
+		k, v, ok := it.Next()
+		if !ok {
+			break
+		}
+		m[string(k)] = string(v.([]byte))
+	}
+	return m
+}
+
+func Test_StoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := s.Put([]byte(fmt.Sprintf("k%03d", i)), []byte(fmt.Sprintf("v%d", i))); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	if err := s.Delete([]byte("k050")); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	tx := s.Txn()
+	tx.Put([]byte("k001"), []byte("updated"))
+	tx.Put([]byte("z"), []byte("z"))
+	tx.Delete([]byte("k002"))
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	tx = s.Txn()
+	tx.Put([]byte("aborted"), []byte("x"))
+	tx.Abort()
+
+	want := dump(s)
+	if len(want) != 99 {
+		t.Fatalf("size = %d, want 99", len(want))
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer func() {
+		_ = s.Close()
+	}()
+	if got := dump(s); !reflect.DeepEqual(got, want) {
+		t.Fatalf("reopened store = %v, want %v", got, want)
+	}
+	if v, ok := s.Get([]byte("k001")); !ok || string(v) != "updated" {
+		t.Fatalf("Get(k001) = %q, %v", v, ok)
+	}
+	if _, ok := s.Get([]byte("aborted")); ok {
+		t.Fatalf("aborted key should not exist")
+	}
+}
+
+func Test_StoreCallerBuffers(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer func() {
+		_ = s.Close()
+	}()
+	key := []byte("key")
+	val := []byte("val")
+	if err := s.Put(key, val); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	copy(key, "xxx")
+	copy(val, "yyy")
+	if v, ok := s.Get([]byte("key")); !ok || string(v) != "val" {
+		t.Fatalf("Get(key) = %q, %v", v, ok)
+	}
+}
+
+func Test_StoreBadKey(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer func() {
+		_ = s.Close()
+	}()
+	long := bytes.Repeat([]byte("k"), 1<<16)
+	if err := s.Put(nil, []byte("v")); err == nil {
+		t.Fatalf("Put(empty key) succeeded")
+	}
+	if err := s.Put(long, []byte("v")); err == nil {
+		t.Fatalf("Put(long key) succeeded")
+	}
+	if err := s.Delete(nil); err == nil {
+		t.Fatalf("Delete(empty key) succeeded")
+	}
+	tx := s.Txn()
+	if err := tx.Put(long, []byte("v")); err == nil {
+		t.Fatalf("Txn.Put(long key) succeeded")
+	}
+	if tx.Delete(nil) {
+		t.Fatalf("Txn.Delete(empty key) found a key")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	// The writer lock was released each time.
+	if err := s.Put([]byte("k"), []byte("v")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+}
+
+func Test_StoreTxnEnded(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer func() {
+		_ = s.Close()
+	}()
+	committed := s.Txn()
+	committed.Put([]byte("k"), []byte("v"))
+	if err := committed.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	aborted := s.Txn()
+	aborted.Abort()
+	for name, tx := range map[string]*Txn{"committed": committed, "aborted": aborted} {
+		if err := tx.Put([]byte("k"), []byte("w")); !errors.Is(err, errTxnEnd) {
+			t.Fatalf("%s: Put = %v, want %v", name, err, errTxnEnd)
+		}
+		if _, ok := tx.Get([]byte("k")); ok {
+			t.Fatalf("%s: Get found a key", name)
+		}
+		if tx.Delete([]byte("k")) {
+			t.Fatalf("%s: Delete found a key", name)
+		}
+	}
+	if v, ok := s.Get([]byte("k")); !ok || string(v) != "v" {
+		t.Fatalf("Get(k) = %q, %v", v, ok)
+	}
+}
+
+func Test_StoreTxnTooLarge(t *testing.T) {
+	defer func(orig uint32) {
+		maxRecordSize = orig
+	}(maxRecordSize)
+	maxRecordSize = 100
+
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := s.Put([]byte("a"), []byte("1")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	tx := s.Txn()
+	tx.Put([]byte("big"), bytes.Repeat([]byte("x"), 200))
+	if err := tx.Commit(); !errors.Is(err, errRecordTooLarge) {
+		t.Fatalf("Commit = %v, want %v", err, errRecordTooLarge)
+	}
+	if _, ok := s.Get([]byte("big")); ok {
+		t.Fatalf("rejected transaction is visible")
+	}
+	if err := s.Put([]byte("b"), []byte("2")); err != nil {
+		t.Fatalf("Put after rejected commit: %v", err)
+	}
+	want := dump(s)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer func() {
+		_ = s.Close()
+	}()
+	if got := dump(s); !reflect.DeepEqual(got, want) || len(got) != 2 {
+		t.Fatalf("reopened store = %v, want %v", got, want)
+	}
+}
+
+func Test_StoreConcurrentGet(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer func() {
+		_ = s.Close()
+	}()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			_ = s.Put([]byte(fmt.Sprintf("k%03d", i)), []byte("v"))
+		}
+	}()
+	for i := 0; ; i++ {
+		select {
+		case <-done:
+			if s.Size() != 200 {
+				t.Fatalf("size = %d, want 200", s.Size())
+			}
+			return
+		default:
+			s.Get([]byte(fmt.Sprintf("k%03d", i%200)))
+		}
+	}
+}
+
+func Test_StoreSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, WithSnapshotEvery(10))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for i := 0; i < 25; i++ {
+		if err := s.Put([]byte(fmt.Sprintf("k%02d", i)), []byte{byte(i)}); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	// 20 commits went into snapshots, 5 remain in the log.
+	if s.walSize == 0 || s.commits != 5 {
+		t.Fatalf("walSize = %d, commits = %d", s.walSize, s.commits)
+	}
+	want := dump(s)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, snapshotFileName)); err != nil {
+		t.Fatalf("snapshot missing: %v", err)
+	}
+
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if got := dump(s); !reflect.DeepEqual(got, want) {
+		t.Fatalf("reopened store = %v, want %v", got, want)
+	}
+	if err := s.Snapshot(); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, walFileName)); err != nil || fi.Size() != 0 {
+		t.Fatalf("wal not truncated: %v %v", fi, err)
+	}
+	_ = s.Close()
+
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer func() {
+		_ = s.Close()
+	}()
+	if got := dump(s); !reflect.DeepEqual(got, want) {
+		t.Fatalf("reopened store = %v, want %v", got, want)
+	}
+}
+
+func Test_StoreCorruptTail(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+	}{
+		{"torn header", func(data []byte) []byte { return append(data, 1, 2, 3) }},
+		{"torn payload", func(data []byte) []byte { return data[:len(data)-2] }},
+		{"bad checksum", func(data []byte) []byte {
+			data[len(data)-1] ^= 0xff
+			return data
+		}},
+		{"garbage", func(data []byte) []byte { return append(data, bytes.Repeat([]byte{0xff}, 32)...) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := Open(dir)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			_ = s.Put([]byte("a"), []byte("1"))
+			_ = s.Put([]byte("b"), []byte("2"))
+			_ = s.Close()
+
+			path := filepath.Join(dir, walFileName)
+			data, _ := os.ReadFile(path)
+			if err := os.WriteFile(path, tt.corrupt(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err = Open(dir)
+			if err != nil {
+				t.Fatalf("reopen: %v", err)
+			}
+			if _, ok := s.Get([]byte("a")); !ok {
+				t.Fatalf("a should survive")
+			}
+			if err := s.Put([]byte("c"), []byte("3")); err != nil {
+				t.Fatalf("Put after recovery: %v", err)
+			}
+			want := dump(s)
+			_ = s.Close()
+
+			s, err = Open(dir)
+			if err != nil {
+				t.Fatalf("reopen: %v", err)
+			}
+			defer func() {
+				_ = s.Close()
+			}()
+			if got := dump(s); !reflect.DeepEqual(got, want) {
+				t.Fatalf("store = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+var errCrash = errors.New("injected crash")
+
+// faultFS makes every file operation fail once budget operations have been
+// performed, as if the process had been killed. The write that exhausts the
+// budget is torn halfway.
+type faultFS struct {
+	budget int
+}
+
+func (fs *faultFS) open(name string, flag int, perm os.FileMode) (file, error) {
+	if fs.budget <= 0 {
+		return nil, errCrash
+	}
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: f, fs: fs}, nil
+}
+
+type faultFile struct {
+	*os.File
+	fs *faultFS
+}
+
+func (f *faultFile) step() bool {
+	if f.fs.budget <= 0 {
+		return false
+	}
+	f.fs.budget--
+	return true
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	if !f.step() {
+		return 0, errCrash
+	}
+	if f.fs.budget == 0 {
+		n, _ := f.File.Write(p[:len(p)/2])
+		return n, errCrash
+	}
+	return f.File.Write(p)
+}
+
+func (f *faultFile) Sync() error {
+	if !f.step() {
+		return errCrash
+	}
+	return f.File.Sync()
+}
+
+func (f *faultFile) Truncate(size int64) error {
+	if !f.step() {
+		return errCrash
+	}
+	return f.File.Truncate(size)
+}
+
+func Test_StoreCrashRecovery(t *testing.T) {
+	defer func(orig func(string, int, os.FileMode) (file, error)) {
+		openFile = orig
+	}(openFile)
+
+	const txns = 12
+	for budget := 1; ; budget++ {
+		dir := t.TempDir()
+		fs := &faultFS{budget: budget}
+		openFile = fs.open
+
+		before := map[string]string{}
+		var after map[string]string
+		crashed := false
+		s, err := Open(dir, WithSnapshotEvery(4))
+		if err != nil {
+			crashed = true
+		}
+		for i := 0; !crashed && i < txns; i++ {
+			next := make(map[string]string)
+			for k, v := range before {
+				next[k] = v
+			}
+			tx := s.Txn()
+			for j := 0; j < 3; j++ {
+				k := fmt.Sprintf("k%d", (i*3+j)%7)
+				v := fmt.Sprintf("v%d.%d", i, j)
+				tx.Put([]byte(k), []byte(v))
+				next[k] = v
+			}
+			if i%3 == 2 {
+				k := fmt.Sprintf("k%d", i%7)
+				if tx.Delete([]byte(k)) {
+					delete(next, k)
+				}
+			}
+			if err := tx.Commit(); err != nil {
+				after = next
+				crashed = true
+				break
+			}
+			before = next
+		}
+		if !crashed {
+			t.Logf("covered %d crash points", budget-1)
+			// The budget outlasted the workload: every crash point is covered.
+			_ = s.Close()
+			return
+		}
+
+		openFile = func(name string, flag int, perm os.FileMode) (file, error) {
+			return os.OpenFile(name, flag, perm)
+		}
+		s, err = Open(dir)
+		if err != nil {
+			t.Fatalf("budget %d: reopen: %v", budget, err)
+		}
+		got := dump(s)
+		_ = s.Close()
+		if !reflect.DeepEqual(got, before) && (after == nil || !reflect.DeepEqual(got, after)) {
+			t.Fatalf("budget %d: recovered %v, want %v or %v", budget, got, before, after)
+		}
+	}
+}
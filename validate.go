@@ -0,0 +1,125 @@
+package qp
+
+import (
+	"bytes"
+	"fmt"
+	"unsafe"
+)
+
+// Validate checks the structural invariants of the trie and returns an error
+// describing the first violation found. It is meant for tests and debugging.
+//
+// It checks that every branch has at least two twigs matching its bitmap, that
+// branch indices strictly increase along every path, that all keys under a
+// branch agree on the nibbles before its index and sit in the twig for their
+// nibble at the index, that keys are valid and strictly increasing, that Size
+// matches the number of leaves, that branches count their leaves, that only
+// branches carry the cow flag, and that no reachable twig array is sitting in
+// the node pool.
+func (tr *Trie) Validate() error {
+	return tr.validate()
+}
+
+func (tr *trie[V]) validate() error {
+	if tr.root.isNil() {
+		if tr.root.word != 0 || !isZero(tr.root.val) {
+			return fmt.Errorf("empty root has stray fields")
+		}
+		if tr.size != 0 {
+			return fmt.Errorf("size is %d but the trie is empty", tr.size)
+		}
+		return nil
+	}
+
+	v := validator[V]{pooled: make(map[unsafe.Pointer]struct{})}
+	if tr.pool != nil {
+		for _, l := range tr.pool.free {
+			for _, p := range l {
+				v.pooled[unsafe.Pointer(p)] = struct{}{}
+			}
+		}
+	}
+	if _, _, err := v.check(&tr.root, -1); err != nil {
+		return err
+	}
+	if v.leaves != tr.size {
+		return fmt.Errorf("size is %d but there are %d leaves", tr.size, v.leaves)
+	}
+	return nil
+}
+
+// isZero reports whether v is the zero value, which for a Trie is nil.
+func isZero[V any](v V) bool {
+	var zero V
+	return any(v) == any(zero)
+}
+
+type validator[V any] struct {
+	pooled map[unsafe.Pointer]struct{}
+	prev   []byte
+	leaves int
+}
+
+// check validates the subtree at n, whose parent branch has index parent,
+// and returns its first and last keys.
+func (v *validator[V]) check(n *gnode[V], parent int) (first, last []byte, err error) {
+	if !n.isBranch() {
+		key := n.key()
+		if n.word&^keyLenMask != 0 {
+			return nil, nil, fmt.Errorf("leaf %q has flags %#x", key, n.word&^keyLenMask)
+		}
+		if len(key) == 0 || len(key) > maxKeyBytes {
+			return nil, nil, fmt.Errorf("leaf key length %d out of range", len(key))
+		}
+		if v.prev != nil && bytes.Compare(v.prev, key) >= 0 {
+			return nil, nil, fmt.Errorf("keys out of order: %q before %q", v.prev, key)
+		}
+		v.prev = key
+		v.leaves++
+		return key, key, nil
+	}
+
+	index := n.index()
+	if n.word&^(branchFlag|cowFlag|uint64(nibbleIndexMax)<<indexShift|countMax<<countShift|bitmapMask) != 0 {
+		return nil, nil, fmt.Errorf("branch at index %d has stray bits %#x", index, n.word)
+	}
+	if int(index) <= parent {
+		return nil, nil, fmt.Errorf("branch index %d not greater than parent index %d", index, parent)
+	}
+	if !isZero(n.val) {
+		return nil, nil, fmt.Errorf("branch at index %d has a value", index)
+	}
+	if n.twigOffsetMax() < 2 {
+		return nil, nil, fmt.Errorf("branch at index %d has %d twigs", index, n.twigOffsetMax())
+	}
+	if _, ok := v.pooled[n.ptr]; ok {
+		return nil, nil, fmt.Errorf("branch at index %d uses a pooled twig array", index)
+	}
+
+	twigs := n.twigs()
+	bitmap := n.bitmap()
+	leaves := v.leaves
+	for i := range twigs {
+		b := bitmap & -bitmap // lowest remaining bit belongs to twig i
+		bitmap &^= b
+		f, l, err := v.check(&twigs[i], int(index))
+		if err != nil {
+			return nil, nil, err
+		}
+		if nibbleBit(index, f) != b || nibbleBit(index, l) != b {
+			return nil, nil, fmt.Errorf("branch at index %d: twig %d holds %q..%q with the wrong nibble", index, i, f, l)
+		}
+		if i == 0 {
+			first = f
+		}
+		last = l
+	}
+	if c := v.leaves - leaves; n.count() != min(c, countMax) {
+		return nil, nil, fmt.Errorf("branch at index %d counts %d leaves but has %d", index, n.count(), c)
+	}
+	// Keys are ordered, so if the first and last agree before index, all do.
+	if common, _ := nibbleIndex(first, last); common < index {
+		return nil, nil, fmt.Errorf("branch at index %d: keys %q and %q differ at nibble %d", index, first, last, common)
+	}
+	return first, last, nil
+}
@@ -0,0 +1,171 @@
+package qp
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// runOps interprets data as a sequence of operations on a trie and checks the
+// trie against a map after every one. The first byte picks trie options; then
+// each operation is an opcode byte followed by a key of 1-4 bytes drawn from
+// a small alphabet, so keys share prefixes and collide often.
+func runOps(t *testing.T, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	var opts []Option
+	if data[0]&1 != 0 {
+		opts = append(opts, WithNodePool())
+	}
+	if data[0]&2 != 0 {
+		opts = append(opts, WithKeyArena())
+	}
+	data = data[1:]
+
+	tr := New(opts...)
+	oracle := map[string]any{}
+	var tx *Txn
+	var txOracle map[string]any
+	cur := func() (*Trie, map[string]any) {
+		if tx != nil {
+			return tx.newTr, txOracle
+		}
+		return tr, oracle
+	}
+
+	for step := 0; len(data) >= 2; step++ {
+		op := data[0]
+		n := 1 + int(data[1])%4
+		data = data[2:]
+		key := make([]byte, n)
+		for i := range key {
+			if len(data) > 0 {
+				key[i] = "\x00\x01\x0f\x10\x11ab\xff"[data[0]%8]
+				data = data[1:]
+			}
+		}
+
+		switch op % 8 {
+		case 0, 1, 2:
+			c, m := cur()
+			old, isUpdate := c.Upsert(key, step)
+			if want, ok := m[string(key)]; ok != isUpdate || old != want {
+				t.Fatalf("step %d: Upsert(%q) got %v, %v want %v, %v", step, key, old, isUpdate, want, ok)
+			}
+			m[string(key)] = step
+		case 3, 4:
+			c, m := cur()
+			old, found := c.Delete(key)
+			if want, ok := m[string(key)]; ok != found || old != want {
+				t.Fatalf("step %d: Delete(%q) got %v, %v want %v, %v", step, key, old, found, want, ok)
+			}
+			delete(m, string(key))
+		case 5:
+			if tx == nil {
+				tx = tr.Txn()
+				txOracle = make(map[string]any, len(oracle))
+				for k, v := range oracle {
+					txOracle[k] = v
+				}
+			}
+		case 6:
+			if tx != nil {
+				tr, oracle = tx.Commit(), txOracle
+				tx = nil
+			}
+		case 7:
+			if tx != nil {
+				tr = tx.Abort()
+				tx = nil
+			}
+		}
+
+		if err := tr.Validate(); err != nil {
+			t.Fatalf("step %d: %v", step, err)
+		}
+		if tx != nil {
+			if err := tx.newTr.Validate(); err != nil {
+				t.Fatalf("step %d: txn: %v", step, err)
+			}
+		}
+	}
+
+	checkTrie(t, tr, oracle)
+	if tx != nil {
+		checkTrie(t, tx.newTr, txOracle)
+	}
+}
+
+func FuzzTrieOps(f *testing.F) {
+	f.Add([]byte{0, 0, 0, 1})
+	f.Add([]byte{1, 0, 1, 5, 6, 0, 2, 5, 6, 7, 5, 3, 1, 5, 6, 6, 0})
+	f.Add([]byte{3, 5, 0, 0, 3, 1, 2, 3, 4, 0, 2, 1, 1, 7, 0, 0, 0, 3, 0, 0})
+	f.Fuzz(runOps)
+}
+
+func Test_ValidateRandomOps(t *testing.T) {
+	rd := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		data := make([]byte, 1+rd.Intn(600))
+		rd.Read(data)
+		runOps(t, data)
+	}
+}
+
+func Test_ValidateWords(t *testing.T) {
+	tr := New()
+	for _, w := range loadTestData(wordsPath) {
+		tr.Upsert(w, nil)
+	}
+	if err := tr.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_ValidateDetects(t *testing.T) {
+	build := func() *Trie {
+		tr := New(WithNodePool())
+		for _, k := range []string{"a", "ab", "b", "ba", "c"} {
+			tr.Upsert([]byte(k), value1)
+		}
+		return tr
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(tr *Trie)
+	}{
+		{"size", func(tr *Trie) { tr.size++ }},
+		{"bitmap", func(tr *Trie) {
+			// Move the lowest bit up, keeping the twig count.
+			bm := tr.root.bitmap()
+			low := bm & -bm
+			high := bitmapT(1 << 16)
+			tr.root.word = tr.root.word&^uint64(low) | uint64(high)
+		}},
+		{"index", func(tr *Trie) { tr.root.twig(0).word &^= uint64(nibbleIndexMax) << indexShift }},
+		{"count", func(tr *Trie) { tr.root.addCount(1) }},
+		{"order", func(tr *Trie) {
+			twigs := tr.root.twigs()
+			twigs[0], twigs[1] = twigs[1], twigs[0]
+		}},
+		{"leaf cow", func(tr *Trie) { tr.root.lastLeaf().word |= cowFlag }},
+		{"wrong twig", func(tr *Trie) { tr.root.lastLeaf().setLeaf([]byte("d"), nil) }},
+		{"pooled", func(tr *Trie) {
+			n := tr.root.twig(0)
+			tr.pool.free[n.twigOffsetMax()] = append(tr.pool.free[n.twigOffsetMax()], (*node)(n.ptr))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := build()
+			if err := tr.Validate(); err != nil {
+				t.Fatalf("valid trie: %v", err)
+			}
+			tt.corrupt(tr)
+			if err := tr.Validate(); err == nil {
+				t.Fatalf("corruption not detected")
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package qp
+
+import "bytes"
+
+// View is the part of a trie under a key prefix, seen with the prefix removed
+// from its keys. Keys passed to a View are relative to the prefix and must not
+// be empty, so a View cannot reach keys outside the prefix, nor the key equal
+// to the prefix itself. Changes through a View change the underlying trie.
+type View struct {
+	tr     *Trie
+	prefix []byte
+}
+
+// View returns the view of tr under prefix.
+func (tr *Trie) View(prefix []byte) *View {
+	return &View{tr: tr, prefix: bytes.Clone(prefix)}
+}
+
+// View returns the view of the transaction's trie under prefix.
+func (tx *Txn) View(prefix []byte) *View {
+	return tx.newTr.View(prefix)
+}
+
+// View returns the view under prefix within v.
+func (v *View) View(prefix []byte) *View {
+	return v.tr.View(v.fullKey(prefix))
+}
+
+// fullKey returns prefix+key in a new slice.
+func (v *View) fullKey(key []byte) []byte {
+	k := make([]byte, 0, len(v.prefix)+len(key))
+	return append(append(k, v.prefix...), key...)
+}
+
+// relKey returns k relative to the prefix, or nil if k is outside the view.
+func (v *View) relKey(k []byte) []byte {
+	if len(k) <= len(v.prefix) || !bytes.HasPrefix(k, v.prefix) {
+		return nil
+	}
+	return k[len(v.prefix):]
+}
+
+// Size returns the number of keys in the view, from the leaf count of the
+// branch the prefix leads to.
+func (v *View) Size() int {
+	n := v.tr.findPrefix(v.prefix)
+	if n == nil {
+		return 0
+	}
+	c := countLeaves(n)
+	if len(v.prefix) > 0 && bytes.Equal(n.firstLeaf().key(), v.prefix) {
+		c--
+	}
+	return c
+}
+
+// Get retrieves the value for key.
+func (v *View) Get(key []byte) (val any, found bool) {
+	must(key)
+	return v.tr.Get(v.fullKey(key))
+}
+
+// Upsert inserts or updates key like Trie.Upsert.
+func (v *View) Upsert(key []byte, value any) (oldVal any, isUpdate bool) {
+	must(key)
+	return v.tr.Upsert(v.fullKey(key), value)
+}
+
+// Delete removes key like Trie.Delete.
+func (v *View) Delete(key []byte) (oldVal any, found bool) {
+	must(key)
+	return v.tr.Delete(v.fullKey(key))
+}
+
+// GetLessOrEqual returns the pair with the largest key in the view that is
+// less than or equal to key, like Trie.GetLessOrEqual.
+func (v *View) GetLessOrEqual(key []byte) (k []byte, val any, exactMatch bool) {
+	must(key)
+	k, val, exactMatch = v.tr.GetLessOrEqual(v.fullKey(key))
+	if k = v.relKey(k); k == nil {
+		return nil, nil, false
+	}
+	return k, val, exactMatch
+}
+
+// Iterator returns an iterator over the view in lexicographical order of the
+// relative keys.
+func (v *View) Iterator() *ViewIterator {
+	it := &ViewIterator{v: v}
+	it.it.Reset(v.tr)
+	it.Seek(nil)
+	return it
+}
+
+// ViewIterator walks the keys of a View in lexicographical order.
+type ViewIterator struct {
+	v  *View
+	it Iterator
+}
+
+// Seek positions the iterator at the first key that is greater than or equal
+// to key. A nil or empty key seeks to the first key of the view.
+func (it *ViewIterator) Seek(key []byte) {
+	if len(it.v.prefix)+len(key) == 0 {
+		it.it.reset(it.it.tr)
+		return
+	}
+	it.it.Seek(it.v.fullKey(key))
+}
+
+// Next returns the next pair with its key relative to the prefix, or ok=false
+// at the end of the view.
+func (it *ViewIterator) Next() (key []byte, value any, ok bool) {
+	for {
+		k, val, ok := it.it.Next()
+		if !ok {
+			return nil, nil, false
+		}
+		if bytes.Equal(k, it.v.prefix) {
+			continue // the prefix itself sorts first
+		}
+		if k = it.v.relKey(k); k == nil {
+			it.it.leaf = nil // past the view
+			return nil, nil, false
+		}
+		return k, val, true
+	}
+}
@@ -0,0 +1,78 @@
+package qp
+
+import (
+	"slices"
+	"testing"
+)
+
+func Test_View(t *testing.T) {
+	tr := New()
+	for _, k := range []string{"a", "t1", "t1/a", "t1/b", "t1/c/d", "t10", "t2/a", "u"} {
+		tr.Upsert([]byte(k), k)
+	}
+	v := tr.View([]byte("t1/"))
+	if v.Size() != 3 {
+		t.Fatalf("Size got %d want 3", v.Size())
+	}
+	if val, found := v.Get([]byte("b")); !found || val != "t1/b" {
+		t.Fatalf("Get got %v %v", val, found)
+	}
+	if _, found := v.Get([]byte("0")); found {
+		t.Fatal("Get of a missing key found it")
+	}
+	if k, val, exact := v.GetLessOrEqual([]byte("c")); string(k) != "b" || val != "t1/b" || exact {
+		t.Fatalf("GetLessOrEqual got %q %v %v", k, val, exact)
+	}
+	if k, _, _ := v.GetLessOrEqual([]byte("\x00")); k != nil {
+		t.Fatalf("GetLessOrEqual escaped the view: %q", k)
+	}
+
+	v.Upsert([]byte("e"), 5)
+	v.Delete([]byte("a"))
+	if val, _ := tr.Get([]byte("t1/e")); val != 5 {
+		t.Fatal("Upsert did not reach the trie")
+	}
+	checkView(t, v, []string{"b", "c/d", "e"})
+	checkView(t, tr.View([]byte("t1")), []string{"/b", "/c/d", "/e", "0"})
+	checkView(t, v.View([]byte("c/")), []string{"d"})
+	checkView(t, tr.View([]byte("x")), nil)
+	checkView(t, tr.View(nil), []string{"a", "t1", "t1/b", "t1/c/d", "t1/e", "t10", "t2/a", "u"})
+
+	it := v.Iterator()
+	it.Seek([]byte("c"))
+	if k, _, _ := it.Next(); string(k) != "c/d" {
+		t.Fatalf("Seek got %q", k)
+	}
+}
+
+func Test_ViewTxn(t *testing.T) {
+	tr := New()
+	tr.Upsert([]byte("t1/a"), value1)
+	tx := tr.Txn()
+	v := tx.View([]byte("t1/"))
+	v.Upsert([]byte("b"), value2)
+	v.Delete([]byte("a"))
+	checkView(t, tr.View([]byte("t1/")), []string{"a"})
+	checkView(t, v, []string{"b"})
+	tr = tx.Commit()
+	checkView(t, tr.View([]byte("t1/")), []string{"b"})
+}
+
+func checkView(t *testing.T, v *View, want []string) {
+	t.Helper()
+	if v.Size() != len(want) {
+		t.Fatalf("Size got %d want %d", v.Size(), len(want))
+	}
+	var got []string
+	it := v.Iterator()
+	for {
+		k, _, ok := it.Next()
+		if !ok {
+			break
+		}
+		got = append(got, string(k))
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("keys got %q want %q", got, want)
+	}
+}
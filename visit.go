@@ -0,0 +1,56 @@
+package qp
+
+// VisitResult tells Visit how to go on after a node.
+type VisitResult int
+
+const (
+	// Continue goes on into the node's subtree, or to the next node.
+	Continue VisitResult = iota
+	// SkipSubtree goes on with the next node after the subtree. For a leaf it
+	// is the same as Continue.
+	SkipSubtree
+	// Stop ends the traversal.
+	Stop
+)
+
+// Visitor is called by Visit for the nodes of a trie.
+type Visitor interface {
+	// VisitBranch is called for a branch with the bytes every key below it
+	// starts with. Keys below a branch can also share the high nibble of the
+	// next byte, so consecutive branches may report the same prefix.
+	// The prefix should not be modified.
+	VisitBranch(prefix []byte) VisitResult
+	// VisitLeaf is called for every key reached. The key should not be modified.
+	VisitLeaf(key []byte, val any) VisitResult
+}
+
+// Visit traverses the trie depth-first in key order, telling v about each
+// branch before its subtree, so v can prune subtrees by their common prefix
+// or stop early.
+func (tr *Trie) Visit(v Visitor) {
+	if !tr.root.isNil() {
+		visit(&tr.root, v)
+	}
+}
+
+// visit reports whether the traversal goes on.
+func visit(n *node, v Visitor) bool {
+	if !n.isBranch() {
+		return v.VisitLeaf(n.key(), n.val) != Stop
+	}
+	// Cap the prefix so a visitor appending to it cannot write into the key.
+	i := n.index() / 2
+	prefix := n.firstLeaf().key()[:i:i]
+	switch v.VisitBranch(prefix) {
+	case Stop:
+		return false
+	case SkipSubtree:
+		return true
+	}
+	for i := range n.twigOffsetMax() {
+		if !visit(n.twig(i), v) {
+			return false
+		}
+	}
+	return true
+}
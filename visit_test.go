@@ -0,0 +1,94 @@
+package qp
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+// prefixSetVisitor collects the keys starting with one of prefixes.
+type prefixSetVisitor struct {
+	prefixes [][]byte
+	keys     []string
+	leaves   int
+	max      int
+}
+
+func (v *prefixSetVisitor) VisitBranch(prefix []byte) VisitResult {
+	for _, p := range v.prefixes {
+		if bytes.HasPrefix(prefix, p) || bytes.HasPrefix(p, prefix) {
+			return Continue
+		}
+	}
+	return SkipSubtree
+}
+
+func (v *prefixSetVisitor) VisitLeaf(key []byte, _ any) VisitResult {
+	v.leaves++
+	for _, p := range v.prefixes {
+		if bytes.HasPrefix(key, p) {
+			v.keys = append(v.keys, string(key))
+			break
+		}
+	}
+	if len(v.keys) == v.max {
+		return Stop
+	}
+	return Continue
+}
+
+// appendVisitor appends to every prefix it is given.
+type appendVisitor struct{}
+
+func (appendVisitor) VisitBranch(prefix []byte) VisitResult {
+	_ = append(prefix, '!')
+	return Continue
+}
+
+func (appendVisitor) VisitLeaf([]byte, any) VisitResult { return Continue }
+
+func Test_Visit(t *testing.T) {
+	words := loadTestData(wordsPath)
+	tr := New()
+	for _, w := range words {
+		tr.Upsert(w, nil)
+	}
+	prefixes := [][]byte{[]byte("zeb"), []byte("quar"), []byte("aardv")}
+
+	var want []string
+	for _, w := range words {
+		for _, p := range prefixes {
+			if bytes.HasPrefix(w, p) {
+				want = append(want, string(w))
+				break
+			}
+		}
+	}
+	slices.Sort(want)
+	want = slices.Compact(want)
+	if len(want) < 3 {
+		t.Fatalf("test data has only %d matching words", len(want))
+	}
+
+	v := &prefixSetVisitor{prefixes: prefixes, max: -1}
+	tr.Visit(v)
+	if !slices.Equal(v.keys, want) {
+		t.Fatalf("got %q want %q", v.keys, want)
+	}
+	if v.leaves > 10*len(want) {
+		t.Fatalf("visited %d leaves for %d keys", v.leaves, len(want))
+	}
+
+	v = &prefixSetVisitor{prefixes: prefixes, max: 2}
+	tr.Visit(v)
+	if !slices.Equal(v.keys, want[:2]) {
+		t.Fatalf("Stop: got %q want %q", v.keys, want[:2])
+	}
+
+	New().Visit(v)
+
+	tr.Visit(appendVisitor{})
+	if err := tr.Validate(); err != nil {
+		t.Fatalf("appending to a prefix changed a key: %v", err)
+	}
+}
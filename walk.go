@@ -1,5 +1,11 @@
 package qp
 
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+)
+
 type WalkFn = func(key []byte, val any) (add bool)
 
 var defaultWalkFn = func(key []byte, val any) (add bool) {
@@ -30,3 +36,87 @@ func (tr *Trie) Walk(max int, f WalkFn) (pairs []KVPair) {
 	}
 	return
 }
+
+// Cursor marks a position in a walk by the last key returned. The zero Cursor
+// is the start of the trie. A Cursor stays valid across changes to the trie
+// and can be sent to clients with MarshalText.
+type Cursor struct {
+	last []byte
+}
+
+const cursorVersion = 1
+
+// Done reports whether c is the end of a finished walk. The zero Cursor is not done.
+func (c Cursor) Done() bool {
+	return c.last != nil && len(c.last) == 0
+}
+
+// MarshalText encodes the cursor as URL-safe base64.
+func (c Cursor) MarshalText() ([]byte, error) {
+	if c.last == nil {
+		return []byte{}, nil
+	}
+	b := append([]byte{cursorVersion}, c.last...)
+	out := make([]byte, base64.RawURLEncoding.EncodedLen(len(b)))
+	base64.RawURLEncoding.Encode(out, b)
+	return out, nil
+}
+
+// UnmarshalText decodes a cursor encoded by MarshalText.
+func (c *Cursor) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*c = Cursor{}
+		return nil
+	}
+	b := make([]byte, base64.RawURLEncoding.DecodedLen(len(text)))
+	n, err := base64.RawURLEncoding.Decode(b, text)
+	if err != nil {
+		return fmt.Errorf("bad cursor: %w", err)
+	}
+	if n == 0 || b[0] != cursorVersion {
+		return fmt.Errorf("bad cursor version")
+	}
+	if n-1 > maxKeyBytes {
+		return fmt.Errorf("bad cursor: %w", errKeyTooLong)
+	}
+	*c = Cursor{last: b[1:n]}
+	return nil
+}
+
+// String returns the text form of the cursor.
+func (c Cursor) String() string {
+	text, _ := c.MarshalText()
+	return string(text)
+}
+
+// WalkFrom is Walk resuming after cursor. It returns the pairs of the page and
+// the cursor to pass for the next one, which is Done once no keys follow.
+// Resuming seeks to the cursor's key, so earlier pages are not walked again.
+func (tr *Trie) WalkFrom(cursor Cursor, max int, f WalkFn) (pairs []KVPair, next Cursor) {
+	if cursor.Done() {
+		return nil, cursor
+	}
+	if f == nil {
+		f = defaultWalkFn
+	}
+	it := tr.Iterator()
+	if cursor.last != nil {
+		it.seekAfter(cursor.last)
+	}
+	for len(pairs) < max {
+		k, v, ok := it.Next()
+		if !ok {
+			break
+		}
+		if add := f(k, v); add {
+			pairs = append(pairs, KVPair{Key: k, Value: v})
+		}
+	}
+	switch {
+	case it.leaf == nil:
+		return pairs, Cursor{last: []byte{}}
+	case len(pairs) == 0:
+		return nil, cursor
+	}
+	return pairs, Cursor{last: bytes.Clone(pairs[len(pairs)-1].Key)}
+}
@@ -2,6 +2,7 @@ package qp
 
 import (
 	"bytes"
+	"fmt"
 	"reflect"
 	"testing"
 )
@@ -101,3 +102,62 @@ func Test_Walk(t *testing.T) {
 		})
 	}
 }
+
+func Test_WalkFrom(t *testing.T) {
+	tr := New()
+	for i := range 100 {
+		tr.Upsert(fmt.Appendf(nil, "k%03d", i), i)
+	}
+	even := func(_ []byte, val any) bool { return val.(int)%2 == 0 }
+
+	var got []any
+	var cursor Cursor
+	for pages := 0; !cursor.Done(); pages++ {
+		if pages > 20 {
+			t.Fatal("WalkFrom does not make progress")
+		}
+		// The cursor survives a round trip through its text form.
+		text, _ := cursor.MarshalText()
+		var c Cursor
+		if err := c.UnmarshalText(text); err != nil {
+			t.Fatal(err)
+		}
+		var pairs []KVPair
+		pairs, cursor = tr.WalkFrom(c, 7, even)
+		for _, p := range pairs {
+			got = append(got, p.Value)
+		}
+		// Changes behind the cursor do not disturb the walk.
+		tr.Delete([]byte("k000"))
+	}
+	if len(got) != 50 {
+		t.Fatalf("got %d values want 50", len(got))
+	}
+	for i, v := range got {
+		if v != i*2 {
+			t.Fatalf("value %d got %v want %d", i, v, i*2)
+		}
+	}
+
+	pairs, next := tr.WalkFrom(Cursor{}, 0, nil)
+	if len(pairs) != 0 || next.Done() {
+		t.Fatal("WalkFrom with max 0")
+	}
+	var c Cursor
+	if err := c.UnmarshalText([]byte("!!")); err == nil {
+		t.Fatal("UnmarshalText accepted a bad cursor")
+	}
+
+	// A cursor at a key of the maximum length resumes after it.
+	long := bytes.Repeat([]byte{'k'}, maxKeyBytes)
+	tr.Upsert(long, -1)
+	tr.Upsert([]byte("l"), -2)
+	pairs, _ = tr.WalkFrom(Cursor{last: long}, 1, nil)
+	if len(pairs) != 1 || string(pairs[0].Key) != "l" {
+		t.Fatalf("WalkFrom after the longest key got %v", pairs)
+	}
+	text, _ := Cursor{last: append(long, 'k')}.MarshalText()
+	if err := c.UnmarshalText(text); err == nil {
+		t.Fatal("UnmarshalText accepted a cursor longer than any key")
+	}
+}